@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// arenaConfidence is the z-score of the confidence intervals of the win rates, 95%
+const arenaConfidence = 1.96
+
+// Arena plays games between two players to compare them, such as two bots or a bot and a GTP engine
+// The players swap colors after every game, so neither keeps the advantage of moving first
+type Arena struct {
+	// first and second are the names of the players, as given to MakePlayer
+	first  string
+	second string
+	games  int
+	// settings are the settings of every game, like in CreateGameFromSettings
+	settings url.Values
+	// directory is where the SGF of every game is written, nothing is written when it's empty
+	directory string
+}
+
+// ArenaResult counts the games the first player won, lost and drew
+type ArenaResult struct {
+	Games  int `json:"games"`
+	Wins   int `json:"wins"`
+	Losses int `json:"losses"`
+	Draws  int `json:"draws"`
+	// BlackWins are the wins of the first player when it played black
+	BlackWins  int `json:"blackWins"`
+	BlackGames int `json:"blackGames"`
+}
+
+// MakeArena creates an arena for games between first and second
+// Settings are written like a query string, e.g. "size=9&komi=7&rules=japanese"
+func MakeArena(first string, second string, games int, settings string, directory string) (*Arena, error) {
+	if games < 1 {
+		return nil, errors.New("Invalid number of games: should be at least 1")
+	}
+	for _, name := range []string{first, second} {
+		if strings.EqualFold(name, "human") {
+			return nil, errors.New("Arena players should be bots or GTP engines")
+		}
+	}
+	values, err := url.ParseQuery(settings)
+	if err != nil {
+		return nil, err
+	}
+	// Checks the settings once, rather than failing at the first game
+	_, err = CreateGameFromSettings(values)
+	if err != nil {
+		return nil, err
+	}
+	return &Arena{
+		first,
+		second,
+		games,
+		values,
+		directory,
+	}, nil
+}
+
+// Run plays the games, writes the result of every game and the totals to out, and returns the totals
+func (arena *Arena) Run(out io.Writer) (*ArenaResult, error) {
+	if arena.directory != "" {
+		err := os.MkdirAll(arena.directory, 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+	result := &ArenaResult{}
+	for i := 0; i < arena.games; i++ {
+		// The first player is black in even games
+		firstPiece := Black
+		black, white := arena.first, arena.second
+		if i%2 == 1 {
+			firstPiece = White
+			black, white = white, black
+		}
+		game, err := arena.play(black, white)
+		if err != nil {
+			return nil, fmt.Errorf("Game %d: %s", i+1, err)
+		}
+		if arena.directory != "" {
+			path := filepath.Join(arena.directory, fmt.Sprintf("game-%03d.sgf", i+1))
+			err = ioutil.WriteFile(path, []byte(game.SGF()), 0644)
+			if err != nil {
+				return nil, err
+			}
+		}
+		fmt.Fprintf(out, "Game %d: %s (black) vs %s (white): %s\n", i+1, black, white, game.Result)
+		result.add(game.Result.Outcome.Winner(), firstPiece)
+	}
+	fmt.Fprint(out, result.String(arena.first, arena.second))
+	return result, nil
+}
+
+// play runs a game between the named players, who are created for this game only
+// GTP engines quit at the end of every game, and bots don't keep anything from one game to the next
+func (arena *Arena) play(blackName string, whiteName string) (*Game, error) {
+	settings := url.Values{}
+	for key, values := range arena.settings {
+		settings[key] = values
+	}
+	settings.Set("black", blackName)
+	settings.Set("white", whiteName)
+	game, err := CreateGameFromSettings(settings)
+	if err != nil {
+		return nil, err
+	}
+	black, err := MakePlayer(blackName, nil, ioutil.Discard)
+	if err != nil {
+		return nil, err
+	}
+	white, err := MakePlayer(whiteName, nil, ioutil.Discard)
+	if err != nil {
+		black.GameOver(game)
+		return nil, err
+	}
+	err = game.Start(black, white)
+	if err != nil {
+		black.GameOver(game)
+		white.GameOver(game)
+		return nil, err
+	}
+	return game, nil
+}
+
+// add counts a game the first player played with firstPiece, and winner won
+func (result *ArenaResult) add(winner Piece, firstPiece Piece) {
+	result.Games++
+	if firstPiece == Black {
+		result.BlackGames++
+	}
+	switch winner {
+	case Empty:
+		result.Draws++
+	case firstPiece:
+		result.Wins++
+		if firstPiece == Black {
+			result.BlackWins++
+		}
+	default:
+		result.Losses++
+	}
+}
+
+// WinRate is the score of the first player, draws count as half a win
+func (result *ArenaResult) WinRate() float64 {
+	if result.Games == 0 {
+		return 0
+	}
+	return (float64(result.Wins) + float64(result.Draws)/2) / float64(result.Games)
+}
+
+// ConfidenceInterval is the 95% Wilson score interval of the win rate of the first player
+// It stays between 0 and 1, and is meaningful even after a handful of games
+func (result *ArenaResult) ConfidenceInterval() (float64, float64) {
+	return wilsonInterval(result.WinRate(), result.Games)
+}
+
+// wilsonInterval is the Wilson score interval of the rate of successes in games trials
+func wilsonInterval(rate float64, games int) (float64, float64) {
+	if games == 0 {
+		return 0, 1
+	}
+	n := float64(games)
+	z2 := arenaConfidence * arenaConfidence
+	center := (rate + z2/(2*n)) / (1 + z2/n)
+	margin := arenaConfidence / (1 + z2/n) * math.Sqrt(rate*(1-rate)/n+z2/(4*n*n))
+	return math.Max(0, center-margin), math.Min(1, center+margin)
+}
+
+// String writes the totals from the point of view of each player
+func (result *ArenaResult) String(first string, second string) string {
+	var text strings.Builder
+	low, high := result.ConfidenceInterval()
+	rate := result.WinRate()
+	fmt.Fprintf(&text, "%d games, %d wins, %d losses, %d draws\n", result.Games, result.Wins, result.Losses, result.Draws)
+	fmt.Fprintf(&text, "%s: %.1f%% (95%% CI %.1f%% - %.1f%%)\n", first, rate*100, low*100, high*100)
+	fmt.Fprintf(&text, "%s: %.1f%% (95%% CI %.1f%% - %.1f%%)\n", second, (1-rate)*100, (1-high)*100, (1-low)*100)
+	whiteGames := result.Games - result.BlackGames
+	whiteWins := result.Wins - result.BlackWins
+	if result.BlackGames > 0 {
+		fmt.Fprintf(&text, "%s as black: %d/%d wins\n", first, result.BlackWins, result.BlackGames)
+	}
+	if whiteGames > 0 {
+		fmt.Fprintf(&text, "%s as white: %d/%d wins\n", first, whiteWins, whiteGames)
+	}
+	return text.String()
+}
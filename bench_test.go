@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// playout plays random moves until there's no room left, or both players pass
+func playout(board Goban, random *rand.Rand) {
+	width, height := board.Size()
+	turn := Black
+	passes := 0
+	for moves := 0; moves < width*height*3 && passes < 2; moves++ {
+		move := MakePass(turn)
+		// A few tries to find a legal move before passing
+		for try := 0; try < 10; try++ {
+			candidate := &Move{random.Intn(width), random.Intn(height), turn}
+			if board.Move(candidate) == nil {
+				move = candidate
+				break
+			}
+		}
+		if move.IsPass() {
+			board.Move(move)
+			passes++
+		} else {
+			passes = 0
+		}
+		turn = turn.Opponent()
+	}
+}
+
+// benchmarkPlayouts runs random playouts on the boards made by makeBoard, for every board size
+func benchmarkPlayouts(b *testing.B, makeBoard func(size int) Goban) {
+	for _, size := range []int{9, 13, 19} {
+		b.Run(fmt.Sprintf("%dx%d", size, size), func(b *testing.B) {
+			b.ReportAllocs()
+			random := rand.New(rand.NewSource(1))
+			for i := 0; i < b.N; i++ {
+				playout(makeBoard(size), random)
+			}
+		})
+	}
+}
+
+func BenchmarkPlayoutBoard(b *testing.B) {
+	benchmarkPlayouts(b, func(size int) Goban {
+		board := MakeBoard(size, size)
+		board.SetRules(ruleSets[DefaultRules])
+		return board
+	})
+}
+
+func BenchmarkPlayoutBitBoard(b *testing.B) {
+	benchmarkPlayouts(b, func(size int) Goban {
+		board := MakeBitBoard(size, size)
+		board.SetRules(ruleSets[DefaultRules])
+		return board
+	})
+}
+
+// BenchmarkMCTS times a move of the MCTS bot, which is mostly playouts on bitboards
+func BenchmarkMCTS(b *testing.B) {
+	for _, size := range []int{9, 13, 19} {
+		b.Run(fmt.Sprintf("%dx%d", size, size), func(b *testing.B) {
+			game := CreateGame(size, size, ruleSets[DefaultRules])
+			bot := MakeMCTSPlayer(1000, time.Minute, 1)
+			for i := 0; i < b.N; i++ {
+				bot.GenMove(game, Black)
+			}
+			b.ReportMetric(float64(bot.playouts*b.N)/b.Elapsed().Seconds(), "playouts/s")
+		})
+	}
+}
+
+// TestBitBoardMoveAllocations checks moves are played on bitboards without allocating, legal or not
+// White's stone at (1, 1) is taken in a ko, and playing it again right away is rejected
+func TestBitBoardMoveAllocations(t *testing.T) {
+	start := MakeBitBoard(5, 5)
+	start.SetRules(ruleSets[DefaultRules])
+	moves := []struct {
+		move  Move
+		legal bool
+	}{
+		{Move{1, 0, Black}, true},
+		{Move{2, 0, White}, true},
+		{Move{0, 1, Black}, true},
+		{Move{1, 1, White}, true},
+		{Move{1, 2, Black}, true},
+		{Move{3, 1, White}, true},
+		{Move{4, 4, Black}, true},
+		{Move{2, 2, White}, true},
+		{Move{2, 1, Black}, true},
+		{Move{1, 1, White}, false},
+		{Move{2, 1, White}, false},
+		{Move{5, 0, White}, false},
+		{Move{0, 0, White}, false},
+		{*MakePass(White), true},
+	}
+	board := start.Clone()
+	allocations := testing.AllocsPerRun(100, func() {
+		*board = *start
+		for i := range moves {
+			if (board.Move(&moves[i].move) == nil) != moves[i].legal {
+				t.Fatalf("%s should be legal: %t", &moves[i].move, moves[i].legal)
+			}
+		}
+	})
+	if allocations != 0 {
+		t.Fatalf("%v allocations for %d moves", allocations, len(moves))
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"errors"
+	"math/bits"
+)
+
+// Goban is a board pieces can be played on
+// Board keeps the full history and chains, BitBoard is compact for bots playing many games
+type Goban interface {
+	Move(move *Move) error
+	Pieces() [][]string
+	Captures() Captures
+	Size() (int, int)
+}
+
+// Rejected moves return these errors without allocating, as playouts try many illegal moves
+var (
+	errOutOfBounds = errors.New("Out of bounds")
+	errOccupied    = errors.New("Cell is occupied")
+	errKo          = errors.New("ko")
+)
+
+// bitsetWords fits the biggest board, with a padding column on every row
+const bitsetWords = (maxBoardSize*(maxBoardSize+1) + 63) / 64
+
+// bitset has a bit for every cell of a board
+type bitset [bitsetWords]uint64
+
+func (set *bitset) set(i int) {
+	set[i>>6] |= 1 << uint(i&63)
+}
+
+func (set bitset) has(i int) bool {
+	return set[i>>6]&(1<<uint(i&63)) != 0
+}
+
+func (set bitset) or(other bitset) bitset {
+	for i := range set {
+		set[i] |= other[i]
+	}
+	return set
+}
+
+func (set bitset) and(other bitset) bitset {
+	for i := range set {
+		set[i] &= other[i]
+	}
+	return set
+}
+
+func (set bitset) andNot(other bitset) bitset {
+	for i := range set {
+		set[i] &^= other[i]
+	}
+	return set
+}
+
+func (set bitset) isZero() bool {
+	for i := range set {
+		if set[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (set bitset) count() int {
+	count := 0
+	for i := range set {
+		count += bits.OnesCount64(set[i])
+	}
+	return count
+}
+
+// shiftUp moves every bit n cells towards the higher indexes, n is less than 64
+func (set bitset) shiftUp(n uint) bitset {
+	for i := len(set) - 1; i > 0; i-- {
+		set[i] = set[i]<<n | set[i-1]>>(64-n)
+	}
+	set[0] <<= n
+	return set
+}
+
+// shiftDown moves every bit n cells towards the lower indexes, n is less than 64
+func (set bitset) shiftDown(n uint) bitset {
+	for i := 0; i < len(set)-1; i++ {
+		set[i] = set[i]>>n | set[i+1]<<(64-n)
+	}
+	set[len(set)-1] >>= n
+	return set
+}
+
+// BitBoard is a board kept as one bitset per color
+// Moves are applied without allocating, except for the superko history
+type BitBoard struct {
+	width  int
+	height int
+	// stride is the distance between rows, one more than width so shifts left and right fall off the board
+	stride  int
+	onBoard bitset
+	stones  [3]bitset
+	moves   int
+	// hash is the zobrist hash of the position, previousHash the one before the last move for simple ko
+	hash         uint64
+	previousHash uint64
+	// history has the keys of all positions, kept only for superko rules
+	history  []uint64
+	captures Captures
+	rules    Rules
+}
+
+// MakeBitBoard constructs an empty bitboard of size width*height
+func MakeBitBoard(width int, height int) *BitBoard {
+	board := &BitBoard{
+		width,
+		height,
+		width + 1,
+		bitset{},
+		[3]bitset{},
+		0,
+		0,
+		0,
+		make([]uint64, 1, width*height*2),
+		Captures{},
+		Rules{},
+	}
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			board.onBoard.set(board.index(x, y))
+		}
+	}
+	return board
+}
+
+// BitBoard copies the position of the board, with its ko history, so bots can play on from it
+func (board *Board) BitBoard() *BitBoard {
+	bits := MakeBitBoard(board.width, board.height)
+	bits.SetRules(board.rules)
+	for x := 0; x < board.width; x++ {
+		for y := 0; y < board.height; y++ {
+			if piece := board.data[x][y].piece; piece != Empty {
+				bits.stones[piece].set(bits.index(x, y))
+			}
+		}
+	}
+	bits.moves = board.moves
+	bits.hash = board.hash
+	bits.captures = board.captures
+	history := board.boardHistory
+	if len(history.hashes) > 1 {
+		bits.previousHash = history.hashes[len(history.hashes)-2]
+	}
+	bits.history = bits.history[:0]
+	for i := range history.hashes {
+		bits.history = append(bits.history, bits.historyKey(history.hashes[i], history.next[i]))
+	}
+	return bits
+}
+
+// SetRules selects the rules moves are validated by
+// The starting position is kept in the history with black to move, like on Board
+func (board *BitBoard) SetRules(rules Rules) {
+	board.rules = rules
+	if board.moves == 0 && len(board.history) == 1 {
+		board.history[0] = board.historyKey(board.hash, Black)
+	}
+}
+
+// Clone copies the board so it can be played on separately
+func (board *BitBoard) Clone() *BitBoard {
+	clone := *board
+	clone.history = make([]uint64, len(board.history), cap(board.history))
+	copy(clone.history, board.history)
+	return &clone
+}
+
+func (board *BitBoard) index(x int, y int) int {
+	return y*board.stride + x
+}
+
+// Inbounds checks (x, y) is on the board
+func (board *BitBoard) Inbounds(x int, y int) bool {
+	return x >= 0 && x < board.width && y >= 0 && y < board.height
+}
+
+// Size is the width and height of the board
+func (board *BitBoard) Size() (int, int) {
+	return board.width, board.height
+}
+
+// Captures is the number of prisoners each color took so far
+func (board *BitBoard) Captures() Captures {
+	return board.captures
+}
+
+// At is the piece at (x, y)
+func (board *BitBoard) At(x int, y int) Piece {
+	i := board.index(x, y)
+	switch {
+	case board.stones[White].has(i):
+		return White
+	case board.stones[Black].has(i):
+		return Black
+	default:
+		return Empty
+	}
+}
+
+func (board *BitBoard) Pieces() [][]string {
+	data := make([][]string, board.width)
+	for x := range data {
+		data[x] = make([]string, board.height)
+		for y := range data[x] {
+			data[x][y] = board.At(x, y).String()
+		}
+	}
+	return data
+}
+
+// empty are the cells without a piece
+func (board *BitBoard) empty() bitset {
+	return board.onBoard.andNot(board.stones[White]).andNot(board.stones[Black])
+}
+
+// dilate grows the set by the cells next to it
+func (board *BitBoard) dilate(set bitset) bitset {
+	stride := uint(board.stride)
+	return set.or(set.shiftUp(1)).or(set.shiftDown(1)).or(set.shiftUp(stride)).or(set.shiftDown(stride)).and(board.onBoard)
+}
+
+// group finds the cells of pieces connected to the cell i
+func (board *BitBoard) group(pieces bitset, i int) bitset {
+	group := bitset{}
+	group.set(i)
+	for {
+		grown := board.dilate(group).and(pieces)
+		if grown == group {
+			return group
+		}
+		group = grown
+	}
+}
+
+// hashOf is the xor of the keys of piece at every cell of the set
+func (board *BitBoard) hashOf(set bitset, piece Piece) uint64 {
+	var hash uint64
+	for w := range set {
+		word := set[w]
+		for word != 0 {
+			i := w*64 + bits.TrailingZeros64(word)
+			hash ^= zobristKey(i%board.stride, i/board.stride, piece)
+			word &= word - 1
+		}
+	}
+	return hash
+}
+
+// Move validates the move and plays it on the board
+func (board *BitBoard) Move(move *Move) error {
+	if move.IsPass() {
+		board.moves++
+		board.previousHash = board.hash
+		if board.rules.Ko != SimpleKo {
+			board.history = append(board.history, board.historyKey(board.hash, move.piece.Opponent()))
+		}
+		return nil
+	}
+	if !board.Inbounds(move.x, move.y) {
+		return errOutOfBounds
+	}
+	i := board.index(move.x, move.y)
+	if !board.empty().has(i) {
+		return errOccupied
+	}
+	opponent := move.piece.Opponent()
+	own := board.stones[move.piece]
+	own.set(i)
+	theirs := board.stones[opponent]
+	placed := bitset{}
+	placed.set(i)
+	empty := board.empty().andNot(placed)
+
+	// Opponent groups next to the move without liberty are captured
+	captured := bitset{}
+	neighbours := board.dilate(placed).and(theirs)
+	for w := range neighbours {
+		word := neighbours[w]
+		for word != 0 {
+			neighbour := w*64 + bits.TrailingZeros64(word)
+			word &= word - 1
+			if captured.has(neighbour) {
+				continue
+			}
+			group := board.group(theirs, neighbour)
+			if board.dilate(group).and(empty).isZero() {
+				captured = captured.or(group)
+			}
+		}
+	}
+	theirs = theirs.andNot(captured)
+	empty = empty.or(captured)
+
+	hash := board.hash ^ zobristKey(move.x, move.y, move.piece) ^ board.hashOf(captured, opponent)
+	suicided := bitset{}
+	ownGroup := board.group(own, i)
+	if board.dilate(ownGroup).and(empty).isZero() {
+		if !board.rules.Suicide || ownGroup.count() == 1 {
+			return errNoLiberty
+		}
+		suicided = ownGroup
+		own = own.andNot(suicided)
+		hash ^= board.hashOf(suicided, move.piece)
+	}
+
+	if board.isKo(hash, opponent) {
+		return errKo
+	}
+	board.stones[move.piece] = own
+	board.stones[opponent] = theirs
+	board.previousHash = board.hash
+	board.hash = hash
+	if board.rules.Ko != SimpleKo {
+		board.history = append(board.history, board.historyKey(hash, opponent))
+	}
+	board.moves++
+	board.captures.Add(move.piece, captured.count())
+	board.captures.Add(opponent, suicided.count())
+	return nil
+}
+
+// historyKey is what's kept of a position for superko
+// Situational superko also keeps the piece to move next
+func (board *BitBoard) historyKey(hash uint64, next Piece) uint64 {
+	if board.rules.Ko == SituationalSuperko {
+		return hash ^ zobristTurn[next]
+	}
+	return hash
+}
+
+// isKo checks if the position with hash, with next to move, is forbidden by the ko rule
+func (board *BitBoard) isKo(hash uint64, next Piece) bool {
+	if board.rules.Ko == SimpleKo {
+		return hash == board.previousHash && board.moves > 0
+	}
+	key := board.historyKey(hash, next)
+	for _, previous := range board.history {
+		if previous == key {
+			return true
+		}
+	}
+	return false
+}
@@ -23,27 +23,48 @@ type Piece int
 const (
 	// Empty is a place which isn't occupied
 	Empty Piece = iota
-	// White is the first player
+	// White is the second player, and gets komi
 	White
-	// Black is the second player
+	// Black is the first player
 	Black
 )
 
-func (p *Piece) MarshalJSON() ([]byte, error) {
-	switch *p {
+func (p Piece) MarshalJSON() ([]byte, error) {
+	switch p {
+	case White, Black:
+		return []byte("\"" + p.Name() + "\""), nil
+	default:
+		return nil, errors.New("Only supports black and white")
+	}
+}
+
+// Name is the color of the piece
+func (piece Piece) Name() string {
+	switch piece {
 	case White:
-		return []byte("\"White\""), nil
+		return "White"
 	case Black:
-		return []byte("\"Black\""), nil
+		return "Black"
 	default:
-		return nil, errors.New("Only supports black and white")
+		return "Empty"
 	}
 }
 
-// Cell has a piece which occupies it, and a number of liberties available to it
+// Opponent is the piece playing against this piece
+func (piece Piece) Opponent() Piece {
+	switch piece {
+	case White:
+		return Black
+	case Black:
+		return White
+	default:
+		return Empty
+	}
+}
+
+// Cell has a piece which occupies it
 type Cell struct {
-	piece   Piece
-	liberty int
+	piece Piece
 }
 
 func (piece Piece) String() string {
@@ -58,25 +79,13 @@ func (piece Piece) String() string {
 	return names[piece]
 }
 
-func (cell Cell) String(printLiberty bool) string {
-	if cell.piece < Empty || cell.piece > Black {
-		return "Unknown"
-	}
-	liberty := " "
-	if printLiberty {
-		liberty = strconv.Itoa(cell.liberty)
-	}
-	return fmt.Sprintf("%s %s   ", cell.piece.String(), liberty)
-
-}
-
 // Grid is a matrix of cells
 type Grid [][]Cell
 
 func (board *Board) Pieces() [][]string {
-	data := make([][]string, board.size)
+	data := make([][]string, board.width)
 	for y := range data {
-		data[y] = make([]string, board.size)
+		data[y] = make([]string, board.height)
 		for x := range data[y] {
 			data[y][x] = board.data[y][x].piece.String()
 		}
@@ -87,13 +96,9 @@ func (board *Board) Pieces() [][]string {
 func (grid *Grid) Clone() Grid {
 	clone := make(Grid, len(*grid))
 	for i := 0; i < len(*grid); i++ {
-		clone[i] = make([]Cell, len(*grid))
-		for y := 0; y < len(*grid); y++ {
-			toClone := (*grid)[i][y]
-			clone[i][y] = Cell{
-				toClone.piece,
-				toClone.liberty,
-			}
+		clone[i] = make([]Cell, len((*grid)[i]))
+		for y := 0; y < len((*grid)[i]); y++ {
+			clone[i][y] = (*grid)[i][y]
 		}
 	}
 	return clone
@@ -101,11 +106,56 @@ func (grid *Grid) Clone() Grid {
 
 // Board is responsible for containing the cells, and history
 type Board struct {
-	size            int
-	data            Grid
-	moves           int
-	boardHistory    BoardQueue
-	movementHistroy MovementQueue
+	width        int
+	height       int
+	data         Grid
+	moves        int
+	boardHistory BoardQueue
+	// tree has the moves played, the current node is the position of data
+	tree     *GameTree
+	captures Captures
+	// hash is the zobrist hash of data, kept up to date on every change
+	hash  uint64
+	rules Rules
+	// chains has the chain of the piece at every cell, or nil for empty cells
+	chains [][]*chain
+	// scratch is where moves are computed before they're committed
+	scratch Grid
+	// version changes whenever the board does, so stale transactions aren't committed
+	version int
+}
+
+// Captures counts the prisoners taken by each color
+type Captures struct {
+	White int `json:"white"`
+	Black int `json:"black"`
+}
+
+// Add gives prisoners to piece
+func (captures *Captures) Add(piece Piece, prisoners int) {
+	switch piece {
+	case White:
+		captures.White += prisoners
+	case Black:
+		captures.Black += prisoners
+	}
+}
+
+// Of is the number of prisoners piece took
+func (captures Captures) Of(piece Piece) int {
+	switch piece {
+	case White:
+		return captures.White
+	case Black:
+		return captures.Black
+	default:
+		return 0
+	}
+}
+
+// Captures is the number of prisoners each color took so far
+func (board *Board) Captures() Captures {
+	return board.captures
 }
 
 func (board *Board) MarshalJSON() ([]byte, error) {
@@ -116,37 +166,71 @@ func (board *Board) MarshalJSON() ([]byte, error) {
 	return bytes, nil
 }
 
-// MakeBoard constructs a board of size size*size
-func MakeBoard(size int) *Board {
-	data := make(Grid, size)
-	for y := range data {
-		data[y] = make([]Cell, size)
-		for x := range data[y] {
-			// Adjust available liberties initially
-			liberties := 4
-			if x == 0 || x == size-1 {
-				liberties--
-			}
-			if y == 0 || y == size-1 {
-				liberties--
-			}
-			// Create the cell
-			data[y][x] = Cell{
+// minBoardSize and maxBoardSize are the limits of each side of the board
+const (
+	minBoardSize = 2
+	maxBoardSize = 25
+)
+
+// ValidateBoardSize checks the board can be made, and its positions hashed
+func ValidateBoardSize(width int, height int) error {
+	if width < minBoardSize || width > maxBoardSize || height < minBoardSize || height > maxBoardSize {
+		return fmt.Errorf("Board of %dx%d is not supported, each side should be %d to %d", width, height, minBoardSize, maxBoardSize)
+	}
+	return nil
+}
+
+// ParseBoardSize reads a board size in the form of "19" or "7x9"
+func ParseBoardSize(data string) (width int, height int, err error) {
+	sides := strings.Split(strings.ToLower(strings.TrimSpace(data)), "x")
+	if len(sides) > 2 {
+		return 0, 0, errors.New("Invalid board size: should be size or widthxheight")
+	}
+	width, err = strconv.Atoi(sides[0])
+	if err != nil {
+		return 0, 0, errors.New("Invalid board size: should be size or widthxheight")
+	}
+	height = width
+	if len(sides) == 2 {
+		height, err = strconv.Atoi(sides[1])
+		if err != nil {
+			return 0, 0, errors.New("Invalid board size: should be size or widthxheight")
+		}
+	}
+	return width, height, ValidateBoardSize(width, height)
+}
+
+// MakeBoard constructs a board of size width*height
+func MakeBoard(width int, height int) *Board {
+	data := make(Grid, width)
+	for x := range data {
+		data[x] = make([]Cell, height)
+		for y := range data[x] {
+			data[x][y] = Cell{
 				Empty,
-				liberties,
 			}
 		}
 	}
 	history := *MakeBoardQueue()
 	snapshot := data.Clone()
-	history.Enqueue(&snapshot)
-	return &Board{
-		size,
+	// Black moves first from the empty board, unless the game says otherwise
+	history.Enqueue(&snapshot, snapshot.Hash(), Black, Captures{})
+	board := &Board{
+		width,
+		height,
 		data,
 		0,
 		history,
-		*MakeMovementQueue(),
+		MakeGameTree(),
+		Captures{},
+		snapshot.Hash(),
+		Rules{},
+		nil,
+		nil,
+		0,
 	}
+	board.buildChains()
+	return board
 }
 
 // Move defines where a player placed a piece in form of x, y
@@ -156,167 +240,162 @@ type Move struct {
 	piece Piece
 }
 
+// passCoordinate marks a move which doesn't place a piece on the board
+const passCoordinate = -1
+
+// MakePass creates a move where the player passes instead of placing a piece
+func MakePass(piece Piece) *Move {
+	return &Move{passCoordinate, passCoordinate, piece}
+}
+
+// IsPass checks if the move is a pass
+func (move *Move) IsPass() bool {
+	return move.x == passCoordinate && move.y == passCoordinate
+}
+
 func (move *Move) String() string {
+	if move.IsPass() {
+		return fmt.Sprintf("%s passes", move.piece.String())
+	}
 	return fmt.Sprintf("%s to (%d, %d)", move.piece.String(), move.x, move.y)
 }
 
+// errNoLiberty is returned for a move which would leave its group without liberty
+var errNoLiberty = errors.New("Not enough liberty")
+
 // Move contains the logic of validating the move and changing the board in accordance
 func (board *Board) Move(move *Move) (err error) {
-	// First check, is it in bounds
-	if !board.Inbounds(move.x, move.y) {
-		err = fmt.Errorf("(%d, %d) isout of bounds", move.x, move.y)
-		return
+	if move.IsPass() {
+		board.Pass(move.piece)
+		return nil
 	}
-	// Second check: Is the cell empty?
-	if board.data[move.x][move.y].piece != Empty {
-		err = fmt.Errorf("cell (%d, %d) is occupied", move.x, move.y)
+	// The board only changes once the move is known to be legal
+	transaction, err := board.Prepare(move)
+	if err != nil {
 		return
 	}
+	return transaction.Commit()
+}
 
-	if board.data[move.x][move.y].liberty == 0 {
-		// Maybe it kills something and allows for liberty
-		err = errors.New("Not enough liberty")
-	}
-	// Updating liberty of neighbours
-	for i := range cellOffsets {
-		newX, newY := move.x+cellOffsets[i][0], move.y+cellOffsets[i][1]
-		if !board.Inbounds(newX, newY) {
-			continue
-		}
-		cell := &board.data[newX][newY]
-		cell.liberty--
+// IsLegal checks if the move can be played, without changing the board
+func (board *Board) IsLegal(move *Move) bool {
+	if move.IsPass() {
+		return true
 	}
-	// Checking neighbour for either a kill, additional liberty
-	for i := range cellOffsets {
-		newX, newY := move.x+cellOffsets[i][0], move.y+cellOffsets[i][1]
-		if !board.Inbounds(newX, newY) {
-			continue
-		}
-		cell := &board.data[newX][newY]
-		// If neighbour is not empty, enemy, and has no liberty
-		// check if it's connected to a piece with liberty
-		if cell.piece != move.piece && cell.piece != Empty && cell.liberty == 0 {
-			if board.KillConfirm(nil, Move{newX, newY, cell.piece}) {
-				err = nil
-				board.Kill(Move{newX, newY, cell.piece})
-			}
-		}
+	_, err := board.outcome(move)
+	return err == nil
+}
 
-		if err != nil && cell.piece == move.piece {
-			if cell.liberty > 0 {
-				err = nil
-			} else {
-				noLiberty := board.KillConfirm(nil, *move)
-				if !noLiberty {
-					err = nil
-				}
+// LegalMoves lists the cells piece can be played at, passing is always legal as well
+func (board *Board) LegalMoves(piece Piece) []Position {
+	moves := []Position{}
+	for x := 0; x < board.width; x++ {
+		for y := 0; y < board.height; y++ {
+			if board.IsLegal(&Move{x, y, piece}) {
+				moves = append(moves, Position{x, y})
 			}
 		}
 	}
-	if err == nil {
-		// 2 moves ago
-		if board.moves > 1 {
-			board.data[move.x][move.y].piece = move.piece
-			if board.boardHistory.IsKo(&(board.data)) {
-				err = errors.New("ko")
-			}
-		}
+	return moves
+}
+
+// Pass records a move where the player doesn't place a piece
+// The board is kept in history as well so ko checks stay aligned with the moves
+func (board *Board) Pass(piece Piece) {
+	board.version++
+	board.moves++
+	board.tree.Play(MakePass(piece))
+	board.boardHistory.Enqueue(&(board.data), board.hash, piece.Opponent(), board.captures)
+}
+
+// Undo takes back the last move or pass, and returns it
+// The board, prisoners and ko history go back to how they were before the move
+func (board *Board) Undo() (*Move, error) {
+	move, err := board.tree.Back()
+	if err != nil {
+		return nil, err
 	}
-	if err == nil {
-		// Place the piece
-		board.data[move.x][move.y].piece = move.piece
-		board.moves++
-		board.movementHistroy.Enqueue(move)
-		board.boardHistory.Enqueue(&(board.data))
-	} else {
-		// Move is illegal so revert to the last board
-		board.data = board.boardHistory.head.Clone()
-		return
+	err = board.boardHistory.Pop()
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	board.version++
+	board.moves--
+	board.data = board.boardHistory.head.Clone()
+	board.hash = board.boardHistory.headHash
+	board.captures = board.boardHistory.headCaptures
+	board.buildChains()
+	return move, nil
 }
 
-// KillConfirm checks if the piece at the move doesn't have any liberty connected to it
-func (board *Board) KillConfirm(visited [][]bool, move Move) bool {
-	// Initilizing visit array
-	if visited == nil {
-		visited := make([][]bool, board.size)
-		for x := range visited {
-			visited[x] = make([]bool, board.size)
-			for y := range visited[x] {
-				visited[x][y] = false
-			}
-		}
-		return board.KillConfirm(visited, move)
+// Setup places a piece before the game starts, such as a handicap stone
+func (board *Board) Setup(x int, y int, piece Piece) error {
+	if board.moves > 0 {
+		return errors.New("Pieces can only be set up before the first move")
 	}
-	// Look for neighbouring allies
-	for i := range cellOffsets {
-		newX, newY := move.x+cellOffsets[i][0], move.y+cellOffsets[i][1]
-		if !board.Inbounds(newX, newY) || board.data[newX][newY].piece != move.piece {
-			continue
-		}
-		cell := board.data[newX][newY]
-		if cell.piece != move.piece {
-			continue
-		}
-		if visited[newX][newY] {
-			continue
-		}
-		visited[newX][newY] = true
-		// Piece at newX, new_ y is an allie, does it have liberty?
-		if cell.liberty > 0 {
-			return false // No kill!
-		}
-		// Maybe it has an allie with liberty
-		if !board.KillConfirm(visited, Move{newX, newY, move.piece}) {
-			return false // No Kill!
-		}
-
+	if !board.Inbounds(x, y) {
+		return fmt.Errorf("(%d, %d) is out of bounds", x, y)
 	}
-	return true // Piece has no more liberty!
+	if board.data[x][y].piece != Empty {
+		return fmt.Errorf("cell (%d, %d) is occupied", x, y)
+	}
+	board.version++
+	board.placeStone(x, y, piece)
+	board.tree.Setup(&Move{x, y, piece})
+	// The set up board is the starting position, with the same piece to move
+	next := board.boardHistory.next[0]
+	board.boardHistory = *MakeBoardQueue()
+	board.boardHistory.Enqueue(&(board.data), board.hash, next, board.captures)
+	return nil
 }
 
-// Kill is emptying the piece/s connected to the move
-func (board *Board) Kill(move Move) {
-	board.data[move.x][move.y].piece = Empty
-	for i := range cellOffsets {
-		newX, newY := move.x+cellOffsets[i][0], move.y+cellOffsets[i][1]
-		if !board.Inbounds(newX, newY) {
-			continue
-		}
-		cell := &board.data[newX][newY]
-		cell.liberty++
+// SetStartingTurn sets the piece to move from the starting position, which situational superko compares with
+// It can only be changed before the first move
+func (board *Board) SetStartingTurn(piece Piece) error {
+	if len(board.boardHistory.next) != 1 {
+		return errors.New("Starting turn can only be changed before the first move")
 	}
+	board.boardHistory.next[0] = piece
+	return nil
+}
 
-	for i := range cellOffsets {
-		newX, newY := move.x+cellOffsets[i][0], move.y+cellOffsets[i][1]
-		if !board.Inbounds(newX, newY) || board.data[newX][newY].piece != move.piece {
-			continue
-		}
-		board.Kill(Move{newX, newY, move.piece})
-	}
+// Tree is the game tree of the moves played on the board
+func (board *Board) Tree() *GameTree {
+	return board.tree
+}
+
+// SetRules selects the rules moves are validated by
+func (board *Board) SetRules(rules Rules) {
+	board.rules = rules
 }
 
 func (board *Board) String(printLiberty bool) string {
 	var str strings.Builder
 	str.WriteString("=========         Move #" + strconv.Itoa(board.moves+1) + "    ===================\n")
-	for x := 0; x < board.size; x++ {
-		str.WriteString("  " + strconv.Itoa(x) + "   ")
+	// Columns start after the row numbers
+	str.WriteString(strings.Repeat(" ", len(strconv.Itoa(board.height-1))+1))
+	for x := 0; x < board.width; x++ {
+		str.WriteString(fmt.Sprintf("%-6d", x))
 	}
-	var grid = &board.data
-	str.WriteString(PrintGrid(printLiberty, grid))
+	str.WriteString(board.printGrid(printLiberty))
+	str.WriteString(fmt.Sprintf("Captures: %s %d, %s %d\n", White, board.captures.White, Black, board.captures.Black))
 	str.WriteString("====================================================\n")
 	return str.String()
 }
 
-func PrintGrid(printLiberty bool, grid *Grid) string {
+// printGrid draws the pieces, and optionally the liberties of their chains
+func (board *Board) printGrid(printLiberty bool) string {
 	var str strings.Builder
 	str.WriteString("\n----------------------------------------------------\n")
-	size := len(*grid)
-	for y := 0; y < size; y++ {
-		str.WriteString(strconv.Itoa(y) + "|")
-		for x := 0; x < size; x++ {
-			str.WriteString((*grid)[x][y].String(printLiberty))
+	labelWidth := len(strconv.Itoa(board.height - 1))
+	for y := 0; y < board.height; y++ {
+		str.WriteString(fmt.Sprintf("%*d|", labelWidth, y))
+		for x := 0; x < board.width; x++ {
+			liberty := " "
+			if printLiberty && board.chains[x][y] != nil {
+				liberty = strconv.Itoa(board.Liberties(x, y))
+			}
+			str.WriteString(fmt.Sprintf("%s %-4s", board.data[x][y].piece.String(), liberty))
 		}
 		str.WriteString("\n")
 	}
@@ -325,7 +404,21 @@ func PrintGrid(printLiberty bool, grid *Grid) string {
 }
 
 func (board *Board) Inbounds(x int, y int) bool {
-	return x >= 0 && x < board.size && y >= 0 && y < board.size
+	return x >= 0 && x < board.width && y >= 0 && y < board.height
+}
+
+// Size is the width and height of the board
+func (board *Board) Size() (int, int) {
+	return board.width, board.height
+}
+
+// makeMarks creates a width*height matrix to mark cells, such as visited ones
+func (board *Board) makeMarks() [][]bool {
+	marks := make([][]bool, board.width)
+	for x := range marks {
+		marks[x] = make([]bool, board.height)
+	}
+	return marks
 }
 
 func (board *Board) SafeMove(x int, y int, piece Piece) {
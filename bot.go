@@ -0,0 +1,298 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MakeBot creates a built-in bot by name: "random", "heuristic" or "mcts",
+// the MCTS bot can have its settings after a colon, e.g. "mcts:playouts=5000&time=2s&workers=4"
+func MakeBot(name string) (Player, error) {
+	if strings.HasPrefix(strings.ToLower(name), "mcts:") {
+		return ParseMCTSPlayer(name[len("mcts:"):])
+	}
+	switch strings.ToLower(name) {
+	case "random":
+		return MakeRandomPlayer(), nil
+	case "heuristic":
+		return MakeHeuristicPlayer(), nil
+	case "mcts":
+		return ParseMCTSPlayer("")
+	default:
+		return nil, fmt.Errorf("Unknown bot %s: should be random, heuristic or mcts", name)
+	}
+}
+
+// botTurn answers for the bot playing piece against people on the servers
+// The bot agrees to take back moves, checks the dead pieces, and plays while it's its turn
+// lock guards the game of the server, it's held when botTurn is called and let go while the bot thinks on its snapshot
+func botTurn(game *Game, bot Player, piece Piece, lock sync.Locker) error {
+	err := botAnswer(game, piece)
+	for err == nil && game.Phase == Playing && game.Turn == piece {
+		search := botSearch(game, bot, piece)
+		version := game.Board.version
+		lock.Unlock()
+		move, searchErr := search()
+		lock.Lock()
+		// The move is thought again when the players changed the game in the meantime
+		if game.Board.version == version && game.Phase == Playing && game.Turn == piece {
+			err = botPlay(game, piece, move, searchErr)
+		}
+	}
+	return err
+}
+
+// snapshotSearcher is a bot which can think on a copy of the game, so the game isn't held while it thinks
+type snapshotSearcher interface {
+	// snapshot copies what the bot needs of game, and returns the search for the move of piece
+	snapshot(game *Game, piece Piece) func() (*Move, error)
+}
+
+// botAnswer takes back the move the other player asked for, and checks the dead pieces
+func botAnswer(game *Game, piece Piece) error {
+	if game.undoRequest == piece.Opponent() {
+		err := game.AcceptUndo(piece)
+		if err != nil {
+			return err
+		}
+	}
+	if game.Phase == Scoring && !game.accepted[piece] {
+		if agreesWithDead(game, piece) {
+			_, err := game.AcceptScore(piece)
+			return err
+		}
+		// Disputed pieces are settled by playing on
+		return game.ResumePlay()
+	}
+	return nil
+}
+
+// botSearch returns the search for the next move of the bot
+// Bots searching a snapshot only think once it's called, the others choose their move right away
+func botSearch(game *Game, bot Player, piece Piece) func() (*Move, error) {
+	if searcher, ok := bot.(snapshotSearcher); ok {
+		return searcher.snapshot(game, piece)
+	}
+	move, err := bot.GenMove(game, piece)
+	return func() (*Move, error) {
+		return move, err
+	}
+}
+
+// botPlay plays the move the bot chose, or what the error of its search means
+func botPlay(game *Game, piece Piece, move *Move, err error) error {
+	// The bot loses on time like anyone else when it thinks for too long
+	if game.CheckTime() {
+		return nil
+	}
+	if err == errResign {
+		return game.Resign(piece)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = game.Move(move)
+	if err != nil {
+		return err
+	}
+	if game.Phase == Scoring {
+		// The bot passed after the other player, it agrees with the board as it is
+		_, err = game.AcceptScore(piece)
+	}
+	return err
+}
+
+// agreesWithDead checks the pieces marked dead don't cost piece any points
+// The bot plays until nothing is left to settle, so it counts the board as it is
+func agreesWithDead(game *Game, piece Piece) bool {
+	marked := game.Score()
+	dead := game.dead
+	game.dead = game.Board.makeMarks()
+	asIs := game.Score()
+	game.dead = dead
+	return marked.Lead(piece) >= asIs.Lead(piece)
+}
+
+// isEye checks if (x, y) is an empty cell surrounded by pieces of piece, which piece shouldn't fill
+func isEye(board *Board, x int, y int, piece Piece) bool {
+	if board.data[x][y].piece != Empty {
+		return false
+	}
+	for i := range cellOffsets {
+		newX, newY := x+cellOffsets[i][0], y+cellOffsets[i][1]
+		if board.Inbounds(newX, newY) && board.data[newX][newY].piece != piece {
+			return false
+		}
+	}
+	opponents := 0
+	edge := false
+	for _, dx := range []int{-1, 1} {
+		for _, dy := range []int{-1, 1} {
+			if !board.Inbounds(x+dx, y+dy) {
+				edge = true
+				continue
+			}
+			if board.data[x+dx][y+dy].piece == piece.Opponent() {
+				opponents++
+			}
+		}
+	}
+	return eyeDiagonals(opponents, edge)
+}
+
+// eyeDiagonals tells if a cell surrounded by one color is an eye, from the opponent pieces on its diagonals
+// A cell in the middle can have one opponent piece on its diagonals, cells on the edge none
+func eyeDiagonals(opponents int, edge bool) bool {
+	if edge {
+		return opponents == 0
+	}
+	return opponents < 2
+}
+
+// candidateMoves are the legal moves of piece which don't fill its own eyes
+func candidateMoves(board *Board, piece Piece) []Position {
+	moves := []Position{}
+	for _, move := range board.LegalMoves(piece) {
+		if !isEye(board, move.X, move.Y, piece) {
+			moves = append(moves, move)
+		}
+	}
+	return moves
+}
+
+// RandomPlayer is a bot playing random legal moves, except in its own eyes
+// It passes when there's nothing else left
+type RandomPlayer struct {
+	random *rand.Rand
+}
+
+// MakeRandomPlayer creates a random bot
+func MakeRandomPlayer() *RandomPlayer {
+	return &RandomPlayer{
+		rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// GenMove picks one of the legal moves of piece
+func (player *RandomPlayer) GenMove(game *Game, piece Piece) (*Move, error) {
+	moves := candidateMoves(&game.Board, piece)
+	if len(moves) == 0 {
+		return MakePass(piece), nil
+	}
+	choice := moves[player.random.Intn(len(moves))]
+	return &Move{choice.X, choice.Y, piece}, nil
+}
+
+func (player *RandomPlayer) OpponentMoved(move *Move) {
+}
+
+func (player *RandomPlayer) Undone() {
+}
+
+func (player *RandomPlayer) GameOver(game *Game) {
+}
+
+// HeuristicPlayer is a bot which captures when it can, escapes atari and avoids self-atari
+// Otherwise it plays like the random bot
+type HeuristicPlayer struct {
+	random *rand.Rand
+}
+
+// MakeHeuristicPlayer creates a heuristic bot
+func MakeHeuristicPlayer() *HeuristicPlayer {
+	return &HeuristicPlayer{
+		rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// GenMove picks the move capturing most, then a move saving a chain in atari,
+// then a random move which doesn't leave its own chain in atari
+func (player *HeuristicPlayer) GenMove(game *Game, piece Piece) (*Move, error) {
+	board := &game.Board
+	moves := candidateMoves(board, piece)
+	if len(moves) == 0 {
+		return MakePass(piece), nil
+	}
+	// Shuffle so equally good moves are picked at random
+	player.random.Shuffle(len(moves), func(i, j int) {
+		moves[i], moves[j] = moves[j], moves[i]
+	})
+	var capture *Move
+	captured := 0
+	var escape *Move
+	escaped := 0
+	safe := []*Move{}
+	for _, position := range moves {
+		move := &Move{position.X, position.Y, piece}
+		outcome, err := board.outcome(move)
+		if err != nil {
+			continue
+		}
+		prisoners := 0
+		for _, chain := range outcome.captured {
+			prisoners += len(chain.stones)
+		}
+		if prisoners > captured {
+			capture, captured = move, prisoners
+		}
+		liberties := libertiesAfter(board, move, outcome)
+		if prisoners == 0 && liberties < 2 {
+			continue
+		}
+		safe = append(safe, move)
+		// The move joins chains in atari, and leaves them with more liberties
+		saved := 0
+		for _, ally := range outcome.allies {
+			if len(ally.liberties) == 1 {
+				saved += len(ally.stones)
+			}
+		}
+		if saved > escaped {
+			escape, escaped = move, saved
+		}
+	}
+	switch {
+	case capture != nil:
+		return capture, nil
+	case escape != nil:
+		return escape, nil
+	case len(safe) > 0:
+		return safe[0], nil
+	default:
+		// Every move puts itself in atari
+		position := moves[0]
+		return &Move{position.X, position.Y, piece}, nil
+	}
+}
+
+func (player *HeuristicPlayer) OpponentMoved(move *Move) {
+}
+
+func (player *HeuristicPlayer) Undone() {
+}
+
+func (player *HeuristicPlayer) GameOver(game *Game) {
+}
+
+// libertiesAfter counts the liberties the chain of the move would have, not counting cells freed by captures
+func libertiesAfter(board *Board, move *Move, outcome *moveOutcome) int {
+	position := Position{move.x, move.y}
+	liberties := map[Position]bool{}
+	for i := range cellOffsets {
+		newX, newY := move.x+cellOffsets[i][0], move.y+cellOffsets[i][1]
+		if board.Inbounds(newX, newY) && board.data[newX][newY].piece == Empty {
+			liberties[Position{newX, newY}] = true
+		}
+	}
+	for _, ally := range outcome.allies {
+		for liberty := range ally.liberties {
+			if liberty != position {
+				liberties[liberty] = true
+			}
+		}
+	}
+	return len(liberties)
+}
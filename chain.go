@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// chain is a group of connected pieces of the same color, and the empty cells next to them
+type chain struct {
+	piece     Piece
+	stones    []Position
+	liberties map[Position]bool
+}
+
+// Chain describes a group of connected pieces for clients
+type Chain struct {
+	Piece     Piece      `json:"piece"`
+	Stones    []Position `json:"stones"`
+	Liberties []Position `json:"liberties"`
+}
+
+// InAtari checks if the chain can be captured by the next move
+func (chain *Chain) InAtari() bool {
+	return len(chain.Liberties) == 1
+}
+
+// MarshalJSON adds if the chain is in atari
+func (chain *Chain) MarshalJSON() ([]byte, error) {
+	// chainFields has the fields of Chain without its methods, to avoid recursing
+	type chainFields Chain
+	return json.Marshal(&struct {
+		*chainFields
+		Atari bool `json:"atari"`
+	}{
+		(*chainFields)(chain),
+		chain.InAtari(),
+	})
+}
+
+// Chain finds the group of connected pieces at (x, y) and its liberties
+func (board *Board) Chain(x int, y int) (*Chain, error) {
+	if !board.Inbounds(x, y) {
+		return nil, fmt.Errorf("(%d, %d) is out of bounds", x, y)
+	}
+	found := board.chains[x][y]
+	if found == nil {
+		return nil, fmt.Errorf("cell (%d, %d) is empty", x, y)
+	}
+	stones := make([]Position, len(found.stones))
+	copy(stones, found.stones)
+	liberties := make([]Position, 0, len(found.liberties))
+	for liberty := range found.liberties {
+		liberties = append(liberties, liberty)
+	}
+	sortPositions(stones)
+	sortPositions(liberties)
+	return &Chain{found.piece, stones, liberties}, nil
+}
+
+// Liberties is the number of liberties of the chain at (x, y), or 0 if it's empty
+func (board *Board) Liberties(x int, y int) int {
+	if !board.Inbounds(x, y) || board.chains[x][y] == nil {
+		return 0
+	}
+	return len(board.chains[x][y].liberties)
+}
+
+func sortPositions(positions []Position) {
+	sort.Slice(positions, func(i, j int) bool {
+		if positions[i].X != positions[j].X {
+			return positions[i].X < positions[j].X
+		}
+		return positions[i].Y < positions[j].Y
+	})
+}
+
+// neighbourChains are the distinct chains next to (x, y)
+func (board *Board) neighbourChains(x int, y int) []*chain {
+	chains := []*chain{}
+	for i := range cellOffsets {
+		newX, newY := x+cellOffsets[i][0], y+cellOffsets[i][1]
+		if !board.Inbounds(newX, newY) || board.chains[newX][newY] == nil {
+			continue
+		}
+		neighbour := board.chains[newX][newY]
+		duplicate := false
+		for _, seen := range chains {
+			if seen == neighbour {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			chains = append(chains, neighbour)
+		}
+	}
+	return chains
+}
+
+// moveOutcome is what a move would do to the board, found without changing it
+type moveOutcome struct {
+	// captured are the opponent chains left without liberty
+	captured []*chain
+	// suicide is set when the move removes its own group
+	suicide bool
+	// allies are the chains of the same color the move joins
+	allies []*chain
+	// hash is the hash of the board after the move
+	hash uint64
+}
+
+// outcome checks if the move is legal, and what it would capture
+func (board *Board) outcome(move *Move) (*moveOutcome, error) {
+	// First check, is it in bounds
+	if !board.Inbounds(move.x, move.y) {
+		return nil, fmt.Errorf("(%d, %d) is out of bounds", move.x, move.y)
+	}
+	// Second check: Is the cell empty?
+	if board.data[move.x][move.y].piece != Empty {
+		return nil, fmt.Errorf("cell (%d, %d) is occupied", move.x, move.y)
+	}
+	result := &moveOutcome{nil, false, []*chain{}, board.hash ^ zobristKey(move.x, move.y, move.piece)}
+	hasLiberty := false
+	for i := range cellOffsets {
+		newX, newY := move.x+cellOffsets[i][0], move.y+cellOffsets[i][1]
+		if board.Inbounds(newX, newY) && board.data[newX][newY].piece == Empty {
+			hasLiberty = true
+		}
+	}
+	for _, neighbour := range board.neighbourChains(move.x, move.y) {
+		if neighbour.piece == move.piece {
+			result.allies = append(result.allies, neighbour)
+			// The move takes one liberty, the ally needs another
+			if len(neighbour.liberties) > 1 {
+				hasLiberty = true
+			}
+			continue
+		}
+		// The move takes the last liberty of the opponent
+		if len(neighbour.liberties) == 1 {
+			result.captured = append(result.captured, neighbour)
+			for _, stone := range neighbour.stones {
+				result.hash ^= zobristKey(stone.X, stone.Y, neighbour.piece)
+			}
+		}
+	}
+	if len(result.captured) > 0 {
+		hasLiberty = true
+	}
+	if !hasLiberty {
+		// Suicide of the stone alone would only be a pass which doesn't count as one
+		if !board.rules.Suicide || len(result.allies) == 0 {
+			return nil, errNoLiberty
+		}
+		// Some rules allow suicide, which removes the group of the move
+		result.suicide = true
+		result.hash ^= zobristKey(move.x, move.y, move.piece)
+		for _, ally := range result.allies {
+			for _, stone := range ally.stones {
+				result.hash ^= zobristKey(stone.X, stone.Y, ally.piece)
+			}
+		}
+	}
+	if board.boardHistory.IsKo(result.hash, move.piece.Opponent(), board.rules.Ko) {
+		return nil, errKo
+	}
+	return result, nil
+}
+
+// placeStone puts piece at (x, y), joining it with the chains of the same color
+// and taking a liberty from the chains of the other color
+func (board *Board) placeStone(x int, y int, piece Piece) *chain {
+	position := Position{x, y}
+	board.data[x][y].piece = piece
+	board.hash ^= zobristKey(x, y, piece)
+	placed := &chain{piece, []Position{position}, map[Position]bool{}}
+	for i := range cellOffsets {
+		newX, newY := x+cellOffsets[i][0], y+cellOffsets[i][1]
+		if board.Inbounds(newX, newY) && board.data[newX][newY].piece == Empty {
+			placed.liberties[Position{newX, newY}] = true
+		}
+	}
+	board.chains[x][y] = placed
+	for _, neighbour := range board.neighbourChains(x, y) {
+		delete(neighbour.liberties, position)
+		if neighbour.piece == piece {
+			placed = board.joinChains(placed, neighbour)
+		}
+	}
+	return placed
+}
+
+// joinChains merges the smaller chain into the bigger one
+func (board *Board) joinChains(first *chain, second *chain) *chain {
+	if len(first.stones) < len(second.stones) {
+		first, second = second, first
+	}
+	for _, stone := range second.stones {
+		board.chains[stone.X][stone.Y] = first
+	}
+	first.stones = append(first.stones, second.stones...)
+	for liberty := range second.liberties {
+		first.liberties[liberty] = true
+	}
+	return first
+}
+
+// removeChain empties the cells of the chain, giving liberties to its neighbours
+// Returns the number of pieces removed
+func (board *Board) removeChain(removed *chain) int {
+	for _, stone := range removed.stones {
+		board.data[stone.X][stone.Y].piece = Empty
+		board.hash ^= zobristKey(stone.X, stone.Y, removed.piece)
+		board.chains[stone.X][stone.Y] = nil
+	}
+	for _, stone := range removed.stones {
+		for _, neighbour := range board.neighbourChains(stone.X, stone.Y) {
+			neighbour.liberties[stone] = true
+		}
+	}
+	return len(removed.stones)
+}
+
+// buildChains finds the chains of the pieces on the board from scratch
+func (board *Board) buildChains() {
+	board.chains = make([][]*chain, board.width)
+	for x := range board.chains {
+		board.chains[x] = make([]*chain, board.height)
+	}
+	visited := board.makeMarks()
+	for x := 0; x < board.width; x++ {
+		for y := 0; y < board.height; y++ {
+			piece := board.data[x][y].piece
+			if piece == Empty || visited[x][y] {
+				continue
+			}
+			found := &chain{piece, []Position{}, map[Position]bool{}}
+			stack := []Position{{x, y}}
+			visited[x][y] = true
+			for len(stack) > 0 {
+				stone := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				found.stones = append(found.stones, stone)
+				board.chains[stone.X][stone.Y] = found
+				for i := range cellOffsets {
+					newX, newY := stone.X+cellOffsets[i][0], stone.Y+cellOffsets[i][1]
+					if !board.Inbounds(newX, newY) {
+						continue
+					}
+					switch board.data[newX][newY].piece {
+					case Empty:
+						found.liberties[Position{newX, newY}] = true
+					case piece:
+						if !visited[newX][newY] {
+							visited[newX][newY] = true
+							stack = append(stack, Position{newX, newY})
+						}
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeSystem is what happens once a player used up its main time
+type TimeSystem int
+
+const (
+	// Absolute loses the game when the main time is over
+	Absolute TimeSystem = iota
+	// Fischer adds an increment to the main time after every move
+	Fischer
+	// ByoYomi gives periods of fixed time, a period is only used up when a move takes longer
+	ByoYomi
+	// Canadian gives periods of fixed time to play a number of stones
+	Canadian
+)
+
+func (system TimeSystem) String() string {
+	names := [...]string{
+		"absolute",
+		"fischer",
+		"byoyomi",
+		"canadian",
+	}
+	if system < Absolute || system > Canadian {
+		return "unknown"
+	}
+	return names[system]
+}
+
+func (system TimeSystem) MarshalJSON() ([]byte, error) {
+	return json.Marshal(system.String())
+}
+
+// ParseTimeSystem reads a time system by name
+func ParseTimeSystem(name string) (TimeSystem, error) {
+	switch strings.ToLower(name) {
+	case "absolute":
+		return Absolute, nil
+	case "fischer":
+		return Fischer, nil
+	case "byoyomi", "byo-yomi":
+		return ByoYomi, nil
+	case "canadian":
+		return Canadian, nil
+	default:
+		return Absolute, fmt.Errorf("Unknown time system %s: should be absolute, fischer, byoyomi or canadian", name)
+	}
+}
+
+// maxClockTime is the longest main time or period a game can have
+const maxClockTime = 24 * time.Hour
+
+// errOutOfTime is returned by a move played after the time of the player was over
+var errOutOfTime = errors.New("Out of time")
+
+// TimeControl is the time each player gets for the game
+type TimeControl struct {
+	System TimeSystem
+	// Main is the time before overtime
+	Main time.Duration
+	// Increment is added after every move with Fischer
+	Increment time.Duration
+	// Period is the time of an overtime period, for byo-yomi and Canadian
+	Period time.Duration
+	// Periods is the number of byo-yomi periods
+	Periods int
+	// Stones are the stones to play in every Canadian period
+	Stones int
+}
+
+// ParseTimeControl reads the time control from the settings of a game, it's nil when "time" isn't set
+// "time" is the time system, "main" the main time like "10m", "increment" the Fischer increment,
+// "period" the length of the overtime periods, "periods" the byo-yomi periods, and "stones" the stones of a Canadian period
+func ParseTimeControl(settings url.Values) (*TimeControl, error) {
+	if settings.Get("time") == "" {
+		return nil, nil
+	}
+	system, err := ParseTimeSystem(settings.Get("time"))
+	if err != nil {
+		return nil, err
+	}
+	control := &TimeControl{system, 10 * time.Minute, 0, 0, 0, 0}
+	switch system {
+	case Fischer:
+		control.Increment = 10 * time.Second
+	case ByoYomi:
+		control.Period, control.Periods = 30*time.Second, 5
+	case Canadian:
+		control.Period, control.Stones = 5*time.Minute, 25
+	}
+	durations := []struct {
+		name  string
+		value *time.Duration
+	}{
+		{"main", &control.Main},
+		{"increment", &control.Increment},
+		{"period", &control.Period},
+	}
+	for _, setting := range durations {
+		if settings.Get(setting.name) == "" {
+			continue
+		}
+		*setting.value, err = time.ParseDuration(settings.Get(setting.name))
+		if err != nil || *setting.value < 0 || *setting.value > maxClockTime {
+			return nil, fmt.Errorf("Invalid %s: should be a duration such as 30s, up to %s", setting.name, maxClockTime)
+		}
+	}
+	counts := []struct {
+		name  string
+		value *int
+	}{
+		{"periods", &control.Periods},
+		{"stones", &control.Stones},
+	}
+	for _, setting := range counts {
+		if settings.Get(setting.name) == "" {
+			continue
+		}
+		*setting.value, err = strconv.Atoi(settings.Get(setting.name))
+		if err != nil || *setting.value < 1 {
+			return nil, fmt.Errorf("Invalid %s: should be at least 1", setting.name)
+		}
+	}
+	switch {
+	case (system == Absolute || system == Fischer) && control.Main == 0:
+		return nil, fmt.Errorf("Invalid main: %s time needs a main time", system)
+	case (system == ByoYomi || system == Canadian) && control.Period == 0:
+		return nil, fmt.Errorf("Invalid period: %s time needs overtime periods", system)
+	}
+	return control, nil
+}
+
+// String describes the time control like the OT property of SGF, e.g. "5x30 byo-yomi"
+func (control *TimeControl) String() string {
+	switch control.System {
+	case Fischer:
+		return fmt.Sprintf("%s fischer", control.Increment)
+	case ByoYomi:
+		return fmt.Sprintf("%dx%s byo-yomi", control.Periods, control.Period)
+	case Canadian:
+		return fmt.Sprintf("%d/%s canadian", control.Stones, control.Period)
+	default:
+		return "absolute"
+	}
+}
+
+// PlayerClock is the time left to a player
+type PlayerClock struct {
+	// Main is the main time left
+	Main time.Duration
+	// Period is the time left in the current overtime period
+	Period time.Duration
+	// Periods are the byo-yomi periods left, with the current one
+	Periods int
+	// Stones are the stones left to play in the current Canadian period
+	Stones int
+}
+
+// MarshalJSON writes the times in milliseconds
+func (player PlayerClock) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		Main    int64 `json:"main"`
+		Period  int64 `json:"period"`
+		Periods int   `json:"periods,omitempty"`
+		Stones  int   `json:"stones,omitempty"`
+	}{
+		player.Main.Milliseconds(),
+		player.Period.Milliseconds(),
+		player.Periods,
+		player.Stones,
+	})
+}
+
+// Clock counts the time of both players, only the player to move uses up time
+type Clock struct {
+	control TimeControl
+	players map[Piece]*PlayerClock
+	// running is the player whose time is running, or Empty when the clock is stopped
+	running Piece
+	// since is when the time of the running player was last counted, it's zero until the clock is started
+	since time.Time
+	// now tells the time, it can be replaced to control the clock
+	now func() time.Time
+}
+
+// MakeClock creates a stopped clock giving both players the time of control
+func MakeClock(control TimeControl) *Clock {
+	players := map[Piece]*PlayerClock{}
+	for _, piece := range []Piece{Black, White} {
+		players[piece] = &PlayerClock{control.Main, control.Period, control.Periods, control.Stones}
+	}
+	return &Clock{
+		control,
+		players,
+		Empty,
+		time.Time{},
+		time.Now,
+	}
+}
+
+// Control is the time control of the clock
+func (clock *Clock) Control() TimeControl {
+	return clock.control
+}
+
+// Started tells if the clock ran at least once
+func (clock *Clock) Started() bool {
+	return !clock.since.IsZero()
+}
+
+// Running is the player whose time is running, or Empty
+func (clock *Clock) Running() Piece {
+	return clock.running
+}
+
+// Run counts the time of the running player, and starts the time of piece instead, Empty stops the clock
+// It returns the player who ran out of time, or Empty
+func (clock *Clock) Run(piece Piece) Piece {
+	now := clock.now()
+	flagged := Empty
+	if clock.running != Empty && clock.spend(clock.players[clock.running], now.Sub(clock.since)) {
+		flagged = clock.running
+	}
+	clock.running = piece
+	clock.since = now
+	return flagged
+}
+
+// Moved gives piece back the time its time system gives after a move
+func (clock *Clock) Moved(piece Piece) {
+	player := clock.players[piece]
+	switch clock.control.System {
+	case Fischer:
+		player.Main += clock.control.Increment
+		if player.Main > maxClockTime {
+			player.Main = maxClockTime
+		}
+	case ByoYomi:
+		if player.Main == 0 {
+			player.Period = clock.control.Period
+		}
+	case Canadian:
+		if player.Main == 0 {
+			player.Stones--
+			if player.Stones <= 0 {
+				player.Period, player.Stones = clock.control.Period, clock.control.Stones
+			}
+		}
+	}
+}
+
+// Remaining is the time left to piece, counting the time it's been thinking if it's running
+func (clock *Clock) Remaining(piece Piece) PlayerClock {
+	player := *clock.players[piece]
+	if piece == clock.running {
+		clock.spend(&player, clock.now().Sub(clock.since))
+	}
+	return player
+}
+
+// Expired is the running player if it's out of time, or Empty
+func (clock *Clock) Expired() Piece {
+	if clock.running == Empty {
+		return Empty
+	}
+	player := *clock.players[clock.running]
+	if clock.spend(&player, clock.now().Sub(clock.since)) {
+		return clock.running
+	}
+	return Empty
+}
+
+// TimeLeft is how long piece can think about its move before losing on time
+func (clock *Clock) TimeLeft(piece Piece) time.Duration {
+	player := clock.Remaining(piece)
+	left := player.Main
+	switch clock.control.System {
+	case ByoYomi:
+		if player.Periods > 0 {
+			left += player.Period + time.Duration(player.Periods-1)*clock.control.Period
+		}
+	case Canadian:
+		left += player.Period
+	}
+	return left
+}
+
+// MoveTime is a fair share of the time of piece for its next move, when movesLeft moves are still expected
+// Bots use it not to lose on time, the overtime of a move is kept with a margin
+func (clock *Clock) MoveTime(piece Piece, movesLeft int) time.Duration {
+	player := clock.Remaining(piece)
+	if movesLeft < 1 {
+		movesLeft = 1
+	}
+	share := player.Main / time.Duration(movesLeft)
+	switch clock.control.System {
+	case Fischer:
+		share += clock.control.Increment
+	case ByoYomi:
+		if player.Periods > 0 {
+			share += player.Period
+		}
+	case Canadian:
+		if player.Main > 0 {
+			share += clock.control.Period / time.Duration(clock.control.Stones)
+		} else {
+			share += player.Period / time.Duration(player.Stones)
+		}
+	}
+	return share * 8 / 10
+}
+
+// spend takes elapsed off the time of player, and tells if the player ran out of time
+// Main time is used first, then the overtime of the time system
+func (clock *Clock) spend(player *PlayerClock, elapsed time.Duration) bool {
+	if elapsed < player.Main {
+		player.Main -= elapsed
+		return false
+	}
+	elapsed -= player.Main
+	player.Main = 0
+	switch clock.control.System {
+	case ByoYomi:
+		// Every period the move took longer than is lost
+		for player.Periods > 0 && elapsed >= player.Period {
+			elapsed -= player.Period
+			player.Periods--
+			player.Period = clock.control.Period
+		}
+		if player.Periods == 0 {
+			player.Period = 0
+			return true
+		}
+		player.Period -= elapsed
+		return false
+	case Canadian:
+		if elapsed >= player.Period {
+			player.Period = 0
+			return true
+		}
+		player.Period -= elapsed
+		return false
+	default:
+		return true
+	}
+}
+
+// String shows the time left to each player, e.g. "Black 9m41s (5x30s), White 10m0s"
+func (clock *Clock) String() string {
+	times := []string{}
+	for _, piece := range []Piece{Black, White} {
+		player := clock.Remaining(piece)
+		text := piece.Name() + " " + player.Main.Round(time.Second).String()
+		switch {
+		case clock.control.System == ByoYomi && player.Main == 0:
+			text += fmt.Sprintf(" (%dx%s)", player.Periods, player.Period.Round(time.Second))
+		case clock.control.System == Canadian && player.Main == 0:
+			text += fmt.Sprintf(" (%d in %s)", player.Stones, player.Period.Round(time.Second))
+		}
+		times = append(times, text)
+	}
+	return strings.Join(times, ", ")
+}
+
+// MarshalJSON writes the time control, the time left to each player counted until now, and whose time is running
+// Times are in milliseconds
+func (clock *Clock) MarshalJSON() ([]byte, error) {
+	var running *Piece
+	if clock.running != Empty {
+		piece := clock.running
+		running = &piece
+	}
+	return json.Marshal(&struct {
+		System    TimeSystem  `json:"system"`
+		Main      int64       `json:"mainTime"`
+		Increment int64       `json:"increment,omitempty"`
+		Period    int64       `json:"periodTime,omitempty"`
+		Periods   int         `json:"periods,omitempty"`
+		Stones    int         `json:"stones,omitempty"`
+		Black     PlayerClock `json:"black"`
+		White     PlayerClock `json:"white"`
+		Running   *Piece      `json:"running"`
+	}{
+		clock.control.System,
+		clock.control.Main.Milliseconds(),
+		clock.control.Increment.Milliseconds(),
+		clock.control.Period.Milliseconds(),
+		clock.control.Periods,
+		clock.control.Stones,
+		clock.Remaining(Black),
+		clock.Remaining(White),
+		running,
+	})
+}
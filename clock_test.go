@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// fakeTime replaces the time of clock, moving it forward is up to the test
+func fakeTime(clock *Clock) *time.Time {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock.now = func() time.Time {
+		return now
+	}
+	return &now
+}
+
+func TestClock(t *testing.T) {
+	tests := []struct {
+		name    string
+		control TimeControl
+		// thinks are how long black takes for each move, white answers right away
+		thinks  []time.Duration
+		want    PlayerClock
+		flagged bool
+	}{
+		{"absolute", TimeControl{Absolute, time.Minute, 0, 0, 0, 0}, []time.Duration{20 * time.Second, 30 * time.Second}, PlayerClock{10 * time.Second, 0, 0, 0}, false},
+		{"absolute out of time", TimeControl{Absolute, time.Minute, 0, 0, 0, 0}, []time.Duration{20 * time.Second, 45 * time.Second}, PlayerClock{}, true},
+		{"fischer", TimeControl{Fischer, time.Minute, 10 * time.Second, 0, 0, 0}, []time.Duration{20 * time.Second, 45 * time.Second}, PlayerClock{15 * time.Second, 0, 0, 0}, false},
+		{"fischer out of time", TimeControl{Fischer, time.Minute, 10 * time.Second, 0, 0, 0}, []time.Duration{20 * time.Second, 55 * time.Second}, PlayerClock{}, true},
+		{"byoyomi", TimeControl{ByoYomi, 10 * time.Second, 0, 30 * time.Second, 3, 0}, []time.Duration{20 * time.Second}, PlayerClock{0, 30 * time.Second, 3, 0}, false},
+		{"byoyomi periods used up", TimeControl{ByoYomi, 10 * time.Second, 0, 30 * time.Second, 3, 0}, []time.Duration{20 * time.Second, 70 * time.Second}, PlayerClock{0, 30 * time.Second, 1, 0}, false},
+		{"byoyomi out of time", TimeControl{ByoYomi, 10 * time.Second, 0, 30 * time.Second, 3, 0}, []time.Duration{20 * time.Second, 95 * time.Second}, PlayerClock{}, true},
+		{"canadian", TimeControl{Canadian, 10 * time.Second, 0, time.Minute, 0, 2}, []time.Duration{20 * time.Second, 20 * time.Second}, PlayerClock{0, time.Minute, 0, 2}, false},
+		{"canadian next period", TimeControl{Canadian, 10 * time.Second, 0, time.Minute, 0, 2}, []time.Duration{20 * time.Second, 20 * time.Second, 20 * time.Second}, PlayerClock{0, 40 * time.Second, 0, 1}, false},
+		{"canadian out of time", TimeControl{Canadian, 10 * time.Second, 0, time.Minute, 0, 2}, []time.Duration{20 * time.Second, 55 * time.Second}, PlayerClock{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock := MakeClock(test.control)
+			now := fakeTime(clock)
+			clock.Run(Black)
+			for i, think := range test.thinks {
+				*now = now.Add(think)
+				// The last move of a flagged player is too late
+				if i == len(test.thinks)-1 && test.flagged {
+					if clock.Expired() != Black {
+						t.Errorf("black should be out of time with %+v", clock.Remaining(Black))
+					}
+					if flagged := clock.Run(White); flagged != Black {
+						t.Errorf("running the clock flagged %s instead of black", flagged)
+					}
+					return
+				}
+				if flagged := clock.Run(Black); flagged != Empty {
+					t.Fatalf("%s flagged after %s", flagged, think)
+				}
+				clock.Moved(Black)
+				clock.Run(White)
+				clock.Run(Black)
+			}
+			if clock.Expired() != Empty {
+				t.Errorf("black out of time with %+v", clock.Remaining(Black))
+			}
+			if remaining := clock.Remaining(Black); remaining != test.want {
+				t.Errorf("black has %+v left, want %+v", remaining, test.want)
+			}
+			if remaining := clock.Remaining(White); remaining.Main != test.control.Main {
+				t.Errorf("white used time while black was thinking: %+v", remaining)
+			}
+		})
+	}
+}
+
+func TestGameOutOfTime(t *testing.T) {
+	settings, err := url.ParseQuery("size=9&time=absolute&main=1m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	game, err := CreateGameFromSettings(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := fakeTime(game.Clock)
+	playSteps(t, game, []string{"4 4", "2 2"})
+	*now = now.Add(time.Minute)
+	result, err := game.Move(&Move{6, 6, Black})
+	if err != errOutOfTime || result != GameOver {
+		t.Fatalf("move after the time was over got %v, %v", result, err)
+	}
+	if game.Phase != Finished || game.Result == nil || game.Result.Outcome != WhiteWins || game.Result.Reason != "time" {
+		t.Errorf("white should win on time, got %v in %s", game.Result, game.Phase)
+	}
+	if game.Clock.Running() != Empty {
+		t.Errorf("clock of %s still running after the game", game.Clock.Running())
+	}
+}
@@ -1,14 +1,69 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
 )
 
 type Game struct {
-	Board Board   `json:"board"`
-	Turn  Piece   `json:"turn"`
-	Komi  float32 `json:"komi"`
+	Board    Board   `json:"board"`
+	Turn     Piece   `json:"turn"`
+	Komi     float32 `json:"komi"`
+	Rules    Rules   `json:"rules"`
+	Handicap int     `json:"handicap"`
+	Phase    Phase   `json:"phase"`
+	Result   *Result `json:"result,omitempty"`
+	Players  Players `json:"players"`
+	// Clock counts the time of the players, games without time control have none
+	Clock  *Clock `json:"clock,omitempty"`
+	passes int
+	// handicapLeft are the handicap stones the first player still has to place freely
+	handicapLeft int
+	// first is the piece which moved first, komi is given to the other
+	first Piece
+	// dead marks the pieces agreed to be dead during the scoring phase
+	dead [][]bool
+	// accepted has the players who agreed on the dead pieces
+	accepted map[Piece]bool
+	// undoRequest is the piece which asked to take back its last move, or Empty
+	undoRequest Piece
+}
+
+// Phase is the stage the game is in
+type Phase int
+
+const (
+	// Playing is when players place pieces
+	Playing Phase = iota
+	// Scoring is after both players passed, and they mark the dead pieces
+	Scoring
+	// Finished is when the game has a result
+	Finished
+	// Reviewing is after the game, going through its moves and trying variations
+	Reviewing
+)
+
+func (phase Phase) String() string {
+	names := [...]string{
+		"Playing",
+		"Scoring",
+		"Finished",
+		"Reviewing",
+	}
+	if phase < Playing || phase > Reviewing {
+		return "Unknown"
+	}
+	return names[phase]
+}
+
+func (phase Phase) MarshalJSON() ([]byte, error) {
+	return json.Marshal(phase.String())
 }
 
 type MoveResult int
@@ -23,63 +78,658 @@ const (
 type GameResult int
 
 const (
-	WhiteWins = iota
+	WhiteWins GameResult = iota
 	BlackWins
 	Draw
 )
 
-func CreateGame(size int, komi float32) *Game {
-	board := MakeBoard(size)
+func (result GameResult) String() string {
+	names := [...]string{
+		"White wins",
+		"Black wins",
+		"Draw",
+	}
+	if result < WhiteWins || result > Draw {
+		return "Unknown"
+	}
+	return names[result]
+}
+
+func (result GameResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(result.String())
+}
+
+// Winner is the piece which won, or Empty for a draw
+func (result GameResult) Winner() Piece {
+	switch result {
+	case WhiteWins:
+		return White
+	case BlackWins:
+		return Black
+	default:
+		return Empty
+	}
+}
+
+// winnerResult is the game result where piece wins
+func winnerResult(piece Piece) GameResult {
+	if piece == White {
+		return WhiteWins
+	}
+	return BlackWins
+}
+
+// Result describes how a finished game ended
+type Result struct {
+	Outcome GameResult `json:"outcome"`
+	Reason  string     `json:"reason"`
+	Margin  float32    `json:"margin,omitempty"`
+}
+
+func (result *Result) String() string {
+	if result.Margin > 0 {
+		return fmt.Sprintf("%s by %.1f points", result.Outcome, result.Margin)
+	}
+	return fmt.Sprintf("%s by %s", result.Outcome, result.Reason)
+}
+
+// Players are the names of the players of each color, if they're known
+type Players struct {
+	Black string `json:"black,omitempty"`
+	White string `json:"white,omitempty"`
+}
+
+// CreateGame starts a game on a width*height board played by rules
+func CreateGame(width int, height int, rules Rules) *Game {
+	board := MakeBoard(width, height)
+	board.SetRules(rules)
 	game := &Game{
 		*board,
-		White,
-		komi,
+		Black,
+		rules.Komi,
+		rules,
+		0,
+		Playing,
+		nil,
+		Players{},
+		nil,
+		0,
+		0,
+		Black,
+		nil,
+		nil,
+		Empty,
 	}
 	return game
 }
 
-func (game *Game) getMove() (move *Move, err error) {
+// maxKomi is the largest komi a client can choose, in points
+const maxKomi = 1000
+
+// CreateGameFromSettings creates a game with the settings a client chose
+// Settings are optional: "size" is like "19" or "7x9", "rules" is the name of a rule set,
+// "handicap" the number of stones, "komi" replaces the komi of the rules and of the handicap, "time" and the settings of ParseTimeControl the clock, "first" is "white" for old clients which expect white to move first,
+// and "black" and "white" are the names of the players
+func CreateGameFromSettings(settings url.Values) (*Game, error) {
+	width, height := 9, 9
+	if settings.Get("size") != "" {
+		var err error
+		width, height, err = ParseBoardSize(settings.Get("size"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	rules, err := RulesByName(settings.Get("rules"))
+	if err != nil {
+		return nil, err
+	}
+	game := CreateGame(width, height, rules)
+	game.Players = Players{settings.Get("black"), settings.Get("white")}
+	control, err := ParseTimeControl(settings)
+	if err != nil {
+		return nil, err
+	}
+	if control != nil {
+		game.Clock = MakeClock(*control)
+	}
+	switch strings.ToLower(settings.Get("first")) {
+	case "", "black":
+	case "white":
+		err = game.SetFirstPlayer(White)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("Invalid first player: should be black or white")
+	}
+	if settings.Get("handicap") != "" {
+		handicap, err := strconv.Atoi(settings.Get("handicap"))
+		if err != nil {
+			return nil, errors.New("Invalid handicap: should be a number of stones")
+		}
+		err = game.SetHandicap(handicap)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// The komi is set last, as the handicap changes the komi of the rules
+	if settings.Get("komi") != "" {
+		komi, err := strconv.ParseFloat(settings.Get("komi"), 32)
+		if err != nil || math.IsNaN(komi) || math.Abs(komi) > maxKomi {
+			return nil, fmt.Errorf("Invalid komi: should be a number of points, up to %d", maxKomi)
+		}
+		game.Komi = float32(komi)
+	}
+	return game, nil
+}
+
+// ParseMove reads a move in the form of "x y" or "pass"
+func ParseMove(data string, piece Piece) (*Move, error) {
+	data = strings.TrimSpace(data)
+	if strings.EqualFold(data, "pass") {
+		return MakePass(piece), nil
+	}
 	var x int
 	var y int
-	fmt.Printf(game.Board.String(false))
-	fmt.Printf("%s's turn: ", game.Turn)
-	_, err = fmt.Scanf("%d %d", &x, &y)
+	_, err := fmt.Sscanf(data, "%d %d", &x, &y)
 	if err != nil {
-		return nil, errors.New("Invalid move: should be: x, y")
+		return nil, errors.New("Invalid move: should be: x y, or pass")
 	}
-	return &Move{x, y, game.Turn}, nil
-
+	return &Move{x, y, piece}, nil
 }
 
 func (game *Game) Move(move *Move) (MoveResult, error) {
+	switch game.Phase {
+	case Scoring:
+		return GameOver, errors.New("Game is being scored")
+	case Finished:
+		return GameOver, errors.New("Game is over")
+	}
 	if move.piece != game.Turn {
 		return Illegal, errors.New("Not your turn")
 	}
+	// The clock runs while the game is played, not for the moves replayed while reviewing
+	playing := game.Phase == Playing
+	if playing && game.runClock() {
+		return GameOver, errOutOfTime
+	}
 	err := game.Board.Move(move)
 	if err != nil {
 		// TODO komi r
 		return Illegal, err
 	}
-	if game.Turn == White {
-		game.Turn = Black
+	// A move played after taking back another one is the main line, the variations tried in a review aren't
+	if playing {
+		game.Board.tree.Promote()
+	}
+	if move.IsPass() {
+		game.passes++
 	} else {
-		game.Turn = White
+		game.passes = 0
+	}
+	if playing && game.Clock != nil {
+		game.Clock.Moved(move.piece)
+	}
+	// Playing on withdraws the request to take back an earlier move
+	if game.undoRequest == move.piece {
+		game.undoRequest = Empty
+	}
+	// Passing ends the placement of free handicap stones, on boards too small for all of them
+	if move.IsPass() {
+		game.handicapLeft = 0
+	}
+	// The first player keeps the turn until all handicap stones are placed
+	if game.handicapLeft > 0 {
+		game.handicapLeft--
+		if game.handicapLeft > 0 {
+			if playing {
+				game.runClock()
+			}
+			return Ok, nil
+		}
+	}
+	game.Turn = game.Turn.Opponent()
+	// Two consecutive passes end the game, and dead pieces are marked before scoring
+	// A reviewed game already has its result
+	if game.passes >= 2 && playing {
+		game.startScoring()
+		return GameOver, nil
+	}
+	if playing {
+		game.runClock()
 	}
 	return Ok, nil
 
 }
-func (game *Game) Start() {
-	gameOver := false
-	for !gameOver {
-		move, err := game.getMove()
+
+// Undo takes back the last move, restoring the board, turn, prisoners and ko state
+// Undoing the last pass goes back to playing from the scoring phase
+func (game *Game) Undo() error {
+	if game.Phase == Finished {
+		return errors.New("Game is over")
+	}
+	move, err := game.Board.Undo()
+	if err != nil {
+		return err
+	}
+	if game.Phase == Scoring {
+		game.Phase = Playing
+		game.dead = nil
+		game.accepted = nil
+	}
+	game.Turn = move.piece
+	game.passes = 0
+	history := game.Board.tree.Moves()
+	for i := len(history) - 1; i >= 0 && history[i].IsPass(); i-- {
+		game.passes++
+	}
+	// Free handicap stones are moves of the first player, so they're placed again
+	// unless a pass ended their placement
+	if game.Handicap > 0 && len(game.Board.tree.Root().setup) == 0 && game.Board.moves < game.Handicap {
+		game.handicapLeft = game.Handicap - game.Board.moves
+		for _, earlier := range history {
+			if earlier.IsPass() {
+				game.handicapLeft = 0
+			}
+		}
+	}
+	game.undoRequest = Empty
+	if game.Phase == Playing {
+		game.runClock()
+	}
+	return nil
+}
+
+// Redo plays the last move which was taken back
+func (game *Game) Redo() (MoveResult, error) {
+	next := game.Board.tree.Next()
+	if next == nil {
+		return Illegal, errors.New("No moves to redo")
+	}
+	return game.Move(next.move)
+}
+
+// RequestUndo asks the opponent of piece to allow taking back the last move of piece
+func (game *Game) RequestUndo(piece Piece) error {
+	if game.IsOver() {
+		return errors.New("Game is over")
+	}
+	if piece != White && piece != Black {
+		return errors.New("Only white or black can ask to undo")
+	}
+	if game.undoRequest != Empty {
+		return fmt.Errorf("%s already asked to undo", game.undoRequest.Name())
+	}
+	if !game.hasMoved(piece) {
+		return errors.New("No moves to undo")
+	}
+	game.undoRequest = piece
+	return nil
+}
+
+// AcceptUndo agrees to the request of the opponent of piece, taking back moves up to and including its last one
+// When piece already replied, its reply is taken back as well
+func (game *Game) AcceptUndo(piece Piece) error {
+	if game.undoRequest == Empty {
+		return errors.New("No undo was requested")
+	}
+	if piece != game.undoRequest.Opponent() {
+		return errors.New("Only the opponent can accept the undo")
+	}
+	requester := game.undoRequest
+	if !game.hasMoved(requester) {
+		game.undoRequest = Empty
+		return errors.New("No moves to undo")
+	}
+	for {
+		undone := game.Board.tree.Current().move
+		err := game.Undo()
 		if err != nil {
-			fmt.Printf("Invalid move: %s", err.Error())
+			return err
+		}
+		if undone.piece == requester {
+			return nil
+		}
+	}
+}
+
+// DeclineUndo refuses the request of the opponent of piece
+func (game *Game) DeclineUndo(piece Piece) error {
+	if game.undoRequest == Empty {
+		return errors.New("No undo was requested")
+	}
+	if piece != game.undoRequest.Opponent() {
+		return errors.New("Only the opponent can decline the undo")
+	}
+	game.undoRequest = Empty
+	return nil
+}
+
+// UndoRequest is the piece waiting for its undo to be accepted, or nil
+func (game *Game) UndoRequest() *Piece {
+	if game.undoRequest == Empty {
+		return nil
+	}
+	piece := game.undoRequest
+	return &piece
+}
+
+// hasMoved checks if piece has a move which can be taken back
+func (game *Game) hasMoved(piece Piece) bool {
+	for _, move := range game.Board.tree.Moves() {
+		if move.piece == piece {
+			return true
+		}
+	}
+	return false
+}
+
+// Pass is a shortcut for passing on the current turn
+func (game *Game) Pass() (MoveResult, error) {
+	return game.Move(MakePass(game.Turn))
+}
+
+// Resign ends the game with the opponent of piece as the winner
+func (game *Game) Resign(piece Piece) error {
+	if game.IsOver() {
+		return errors.New("Game is over")
+	}
+	if piece != White && piece != Black {
+		return errors.New("Only white or black can resign")
+	}
+	game.Phase = Finished
+	game.Result = &Result{winnerResult(piece.Opponent()), "resignation", 0}
+	game.runClock()
+	return nil
+}
+
+// StartClock starts the time of the player to move, once both players are there
+// Games without a clock, or with a clock already started, aren't changed
+func (game *Game) StartClock() {
+	if game.Clock != nil && !game.Clock.Started() {
+		game.runClock()
+	}
+}
+
+// CheckTime ends the game when the player to move ran out of time, and tells if it did
+// Servers call it to end games of players who stopped playing
+func (game *Game) CheckTime() bool {
+	if game.Clock == nil || game.Phase != Playing {
+		return false
+	}
+	flagged := game.Clock.Expired()
+	if flagged == Empty {
+		return false
+	}
+	game.runClock()
+	return true
+}
+
+// runClock counts the time of the last player, and runs the time of the player to move while the game is played
+// A player who ran out of time loses, and runClock tells if that happened
+func (game *Game) runClock() bool {
+	if game.Clock == nil || !game.Clock.Started() && game.Phase != Playing {
+		return false
+	}
+	running := Empty
+	if game.Phase == Playing {
+		running = game.Turn
+	}
+	flagged := game.Clock.Run(running)
+	if flagged == Empty || game.Phase != Playing {
+		return false
+	}
+	game.Phase = Finished
+	game.Result = &Result{winnerResult(flagged.Opponent()), "time", 0}
+	game.Clock.Run(Empty)
+	return true
+}
+
+// FirstPlayer is the piece which moves first
+func (game *Game) FirstPlayer() Piece {
+	return game.first
+}
+
+// SetFirstPlayer changes which piece moves first, before the game starts
+// Black moves first by default, white first is kept for old clients
+func (game *Game) SetFirstPlayer(piece Piece) error {
+	if game.Board.moves > 0 || game.Handicap > 0 {
+		return errors.New("First player can only be changed before the game starts")
+	}
+	if piece != White && piece != Black {
+		return errors.New("First player should be white or black")
+	}
+	game.first = piece
+	game.Turn = piece
+	return game.Board.SetStartingTurn(piece)
+}
+
+// LegalMoves lists the cells the player whose turn it is can play at
+func (game *Game) LegalMoves() []Position {
+	if game.Phase != Playing && game.Phase != Reviewing {
+		return []Position{}
+	}
+	return game.Board.LegalMoves(game.Turn)
+}
+
+// IsOver checks if the game has a result
+func (game *Game) IsOver() bool {
+	return game.Phase == Finished || game.Phase == Reviewing
+}
+
+func (game *Game) startScoring() {
+	game.Phase = Scoring
+	game.dead = game.Board.makeMarks()
+	game.accepted = make(map[Piece]bool)
+	game.runClock()
+}
+
+// ToggleDead marks the group at (x, y) as dead, or alive if it was marked dead
+func (game *Game) ToggleDead(x int, y int) error {
+	if game.Phase != Scoring {
+		return errors.New("Dead pieces can only be marked after both players passed")
+	}
+	if !game.Board.Inbounds(x, y) {
+		return fmt.Errorf("(%d, %d) is out of bounds", x, y)
+	}
+	piece := game.Board.data[x][y].piece
+	if piece == Empty {
+		return fmt.Errorf("cell (%d, %d) is empty", x, y)
+	}
+	dead := !game.dead[x][y]
+	for _, stone := range game.Board.chains[x][y].stones {
+		game.dead[stone.X][stone.Y] = dead
+	}
+	// Changing the dead pieces requires both players to agree again
+	game.accepted = make(map[Piece]bool)
+	return nil
+}
+
+// DeadPieces lists the positions of the pieces marked dead
+func (game *Game) DeadPieces() []Position {
+	positions := []Position{}
+	for x := range game.dead {
+		for y := range game.dead[x] {
+			if game.dead[x][y] {
+				positions = append(positions, Position{x, y})
+			}
+		}
+	}
+	return positions
+}
+
+// AcceptScore agrees on the dead pieces for piece
+// Once both players agreed the game is scored and finished
+func (game *Game) AcceptScore(piece Piece) (MoveResult, error) {
+	if game.Phase != Scoring {
+		return Illegal, errors.New("Score can only be accepted after both players passed")
+	}
+	if piece != White && piece != Black {
+		return Illegal, errors.New("Only white or black can accept the score")
+	}
+	game.accepted[piece] = true
+	if !game.accepted[White] || !game.accepted[Black] {
+		return Ok, nil
+	}
+	game.Phase = Finished
+	game.Result = game.Score().Result("score")
+	return GameOver, nil
+}
+
+// ResumePlay goes back to playing when the players don't agree on the dead pieces
+func (game *Game) ResumePlay() error {
+	if game.Phase != Scoring {
+		return errors.New("Play can only be resumed while scoring")
+	}
+	game.Phase = Playing
+	game.passes = 0
+	game.dead = nil
+	game.accepted = nil
+	game.runClock()
+	return nil
+}
+
+// scoredBoard is the board with the dead pieces removed and counted as prisoners
+func (game *Game) scoredBoard() *Board {
+	board := game.Board
+	board.data = game.Board.data.Clone()
+	for x := range game.dead {
+		for y := range game.dead[x] {
+			if !game.dead[x][y] {
+				continue
+			}
+			board.captures.Add(board.data[x][y].piece.Opponent(), 1)
+			board.data[x][y].piece = Empty
+		}
+	}
+	return &board
+}
+
+// Score counts the current position by the scoring method of the rules, with komi applied
+func (game *Game) Score() Score {
+	if game.Rules.Scoring == TerritoryScoring {
+		return game.TerritoryScore()
+	}
+	return game.AreaScore()
+}
+
+// AreaScore counts the current position by area with komi applied
+// Can be used to estimate the score of a game in progress
+func (game *Game) AreaScore() Score {
+	score := game.scoredBoard().AreaScore()
+	score.Add(game.first.Opponent(), game.Komi)
+	return score
+}
+
+// TerritoryScore counts the current position by territory and prisoners with komi applied
+func (game *Game) TerritoryScore() Score {
+	score := game.scoredBoard().TerritoryScore()
+	score.Add(game.first.Opponent(), game.Komi)
+	return score
+}
+
+// MarshalJSON adds the prisoners of each color, the dead pieces, the legal moves and the current node next to the board
+func (game *Game) MarshalJSON() ([]byte, error) {
+	// gameFields has the fields of Game without its methods, to avoid recursing
+	type gameFields Game
+	return json.Marshal(&struct {
+		*gameFields
+		Rules       Rules      `json:"rules"`
+		Width       int        `json:"width"`
+		Height      int        `json:"height"`
+		Over        bool       `json:"over"`
+		Captures    Captures   `json:"captures"`
+		Dead        []Position `json:"dead"`
+		LegalMoves  []Position `json:"legalMoves"`
+		UndoRequest *Piece     `json:"undoRequest,omitempty"`
+		Node        int        `json:"node"`
+		Comment     string     `json:"comment,omitempty"`
+		Marks       []Mark     `json:"marks,omitempty"`
+		Tree        *Node      `json:"tree"`
+	}{
+		(*gameFields)(game),
+		game.PlayedRules(),
+		game.Board.width,
+		game.Board.height,
+		game.IsOver(),
+		game.Board.Captures(),
+		game.DeadPieces(),
+		game.LegalMoves(),
+		game.UndoRequest(),
+		game.Board.tree.Current().ID(),
+		game.Board.tree.Current().Comment(),
+		game.Board.tree.Current().Marks(),
+		game.Board.tree.Root(),
+	})
+}
+
+// PlayedRules are the rules of the game with the komi it's played with, which handicap or settings can change
+func (game *Game) PlayedRules() Rules {
+	rules := game.Rules
+	rules.Komi = game.Komi
+	return rules
+}
+
+// Start plays the game until it's over, asking black and white for their moves
+// Players sharing a terminal, or playing against a bot, score the board as it is
+// The clock starts with the game, and a player who takes too long loses on time
+func (game *Game) Start(black Player, white Player) error {
+	players := map[Piece]Player{Black: black, White: white}
+	game.StartClock()
+	for !game.IsOver() {
+		piece := game.Turn
+		move, err := players[piece].GenMove(game, piece)
+		// Whatever the player chose, it's too late once its time is over
+		if game.CheckTime() {
+			continue
+		}
+		switch err {
+		case nil:
+		case errResign:
+			game.Resign(piece)
+			continue
+		case errUndo:
+			// The opponent accepts without asking, so moves are taken back up to the last one of piece
+			moves := game.Board.moves
+			err = game.RequestUndo(piece)
+			if err == nil {
+				err = game.AcceptUndo(piece.Opponent())
+			}
+			if err != nil {
+				fmt.Printf("%s\n", err)
+			}
+			for ; moves > game.Board.moves; moves-- {
+				black.Undone()
+				white.Undone()
+			}
+			continue
+		case io.EOF:
+			return err
+		default:
+			if _, ok := players[piece].(*HumanPlayer); !ok {
+				return err
+			}
+			fmt.Printf("Invalid move: %s\n", err.Error())
 			continue
 		}
 		result, err := game.Move(move)
-		if result != Ok {
+		if err != nil {
+			if _, ok := players[piece].(*HumanPlayer); !ok {
+				return fmt.Errorf("%s played an illegal move %s: %s", piece.Name(), move, err)
+			}
 			fmt.Printf("Illegal move. Try again!\n")
 			continue
 		}
+		players[piece.Opponent()].OpponentMoved(move)
+		if result == GameOver {
+			game.AcceptScore(White)
+			game.AcceptScore(Black)
+		}
+	}
+	black.GameOver(game)
+	// A human playing both colors sees the result once
+	if white != black {
+		white.GameOver(game)
 	}
+	return nil
 }
@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+// koSteps lead to black taking a ko at (2, 1), white can't take back at (1, 1) right away
+//
+//	. X O . .
+//	X . X O .
+//	. X O . .
+var koSteps = []string{"1 0", "2 0", "0 1", "3 1", "1 2", "2 2", "4 4", "1 1", "2 1"}
+
+func TestUndoKo(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []string
+		// move is checked for the player to move after the steps
+		move  string
+		legal bool
+	}{
+		{"ko", nil, "1 1", false},
+		{"ko taken back", []string{"undo"}, "2 1", true},
+		{"ko taken again", []string{"undo", "2 1"}, "1 1", false},
+		{"ko after undoing a threat", []string{"4 3", "4 0", "undo", "undo"}, "1 1", false},
+		{"ko after threats", []string{"4 3", "4 0"}, "1 1", true},
+		{"ko taken back by white", []string{"4 3", "4 0", "1 1"}, "2 1", false},
+		{"ko of white taken back", []string{"4 3", "4 0", "1 1", "undo"}, "1 1", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			game := CreateGame(5, 5, ruleSets["chinese"])
+			playSteps(t, game, koSteps)
+			if game.Board.captures.Of(Black) != 1 {
+				t.Fatalf("black should have taken the ko in %s", game.Board.String(false))
+			}
+			playSteps(t, game, test.steps)
+			move, err := ParseMove(test.move, game.Turn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if game.Board.IsLegal(move) != test.legal {
+				t.Errorf("%s by %s should be legal: %t", test.move, game.Turn, test.legal)
+			}
+			// Taking back moves restores the same board as playing the moves left
+			replayed := CreateGame(5, 5, ruleSets["chinese"])
+			for _, move := range game.Board.Tree().Moves() {
+				_, err := replayed.Move(move)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if replayed.Board.String(false) != game.Board.String(false) || replayed.Board.hash != game.Board.hash {
+				t.Errorf("board %s undone to %s", replayed.Board.String(false), game.Board.String(false))
+			}
+			if replayed.Board.captures != game.Board.captures || replayed.Turn != game.Turn {
+				t.Errorf("captures %+v and %s to move undone to %+v and %s", replayed.Board.captures, replayed.Turn, game.Board.captures, game.Turn)
+			}
+		})
+	}
+}
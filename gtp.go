@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// gtpColumns are the letters of the columns in GTP, I is skipped
+const gtpColumns = "ABCDEFGHJKLMNOPQRSTUVWXYZ"
+
+// gtpCommands are the commands the engine knows, in the order they're listed
+var gtpCommands = []string{
+	"protocol_version",
+	"name",
+	"version",
+	"known_command",
+	"list_commands",
+	"quit",
+	"boardsize",
+	"clear_board",
+	"komi",
+	"fixed_handicap",
+	"set_free_handicap",
+	"play",
+	"genmove",
+	"undo",
+	"showboard",
+	"final_score",
+}
+
+// GTPEngine answers the commands of the Go Text Protocol (version 2) about a game
+// It lets GUIs and tournament managers play against our rules engine
+type GTPEngine struct {
+	game   *Game
+	width  int
+	height int
+	komi   float32
+	rules  Rules
+	// bot chooses the moves asked by genmove
+	bot Player
+}
+
+// MakeGTPEngine creates an engine with an empty 19x19 board and the default rules, playing the moves of bot
+func MakeGTPEngine(bot Player) *GTPEngine {
+	rules, _ := RulesByName(DefaultRules)
+	engine := &GTPEngine{
+		nil,
+		19,
+		19,
+		rules.Komi,
+		rules,
+		bot,
+	}
+	engine.clearBoard()
+	return engine
+}
+
+func (engine *GTPEngine) clearBoard() {
+	engine.game = CreateGame(engine.width, engine.height, engine.rules)
+	engine.game.Komi = engine.komi
+}
+
+// ServeGTP reads commands from in and writes the responses to out until quit or the end of in
+func (engine *GTPEngine) ServeGTP(in io.Reader, out io.Writer) error {
+	reader := bufio.NewReader(in)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		line = cleanGTPLine(line)
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		// Commands may start with a number, which is repeated in the response
+		id := ""
+		if _, err := strconv.Atoi(fields[0]); err == nil {
+			id = fields[0]
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		response, err := engine.Execute(fields[0], fields[1:])
+		if err != nil {
+			fmt.Fprintf(out, "?%s %s\n\n", id, err)
+		} else {
+			fmt.Fprintf(out, "=%s %s\n\n", id, response)
+		}
+		if fields[0] == "quit" {
+			return nil
+		}
+	}
+}
+
+// cleanGTPLine removes comments and control characters, and turns tabs into spaces
+func cleanGTPLine(line string) string {
+	if comment := strings.IndexByte(line, '#'); comment >= 0 {
+		line = line[:comment]
+	}
+	var clean strings.Builder
+	for _, char := range line {
+		switch {
+		case char == '\t':
+			clean.WriteRune(' ')
+		case char < 32 || char == 127:
+		default:
+			clean.WriteRune(char)
+		}
+	}
+	return strings.TrimSpace(clean.String())
+}
+
+// Execute runs a command with its arguments and returns the response
+func (engine *GTPEngine) Execute(command string, args []string) (string, error) {
+	game := engine.game
+	switch command {
+	case "protocol_version":
+		return "2", nil
+	case "name":
+		return "go-in-go", nil
+	case "version":
+		return "1.0", nil
+	case "known_command":
+		if len(args) != 1 {
+			return "", errors.New("syntax error")
+		}
+		for _, known := range gtpCommands {
+			if known == args[0] {
+				return "true", nil
+			}
+		}
+		return "false", nil
+	case "list_commands":
+		return strings.Join(gtpCommands, "\n"), nil
+	case "quit":
+		return "", nil
+	case "boardsize":
+		if len(args) != 1 {
+			return "", errors.New("syntax error")
+		}
+		size, err := strconv.Atoi(args[0])
+		if err != nil {
+			return "", errors.New("syntax error")
+		}
+		if ValidateBoardSize(size, size) != nil {
+			return "", errors.New("unacceptable size")
+		}
+		engine.width, engine.height = size, size
+		engine.clearBoard()
+		return "", nil
+	case "clear_board":
+		engine.clearBoard()
+		return "", nil
+	case "komi":
+		if len(args) != 1 {
+			return "", errors.New("syntax error")
+		}
+		komi, err := strconv.ParseFloat(args[0], 32)
+		if err != nil {
+			return "", errors.New("syntax error")
+		}
+		engine.komi = float32(komi)
+		game.Komi = engine.komi
+		return "", nil
+	case "fixed_handicap":
+		if len(args) != 1 {
+			return "", errors.New("syntax error")
+		}
+		stones, err := strconv.Atoi(args[0])
+		if err != nil {
+			return "", errors.New("syntax error")
+		}
+		if game.Board.moves > 0 || len(game.Board.Tree().Root().setup) > 0 {
+			return "", errors.New("board not empty")
+		}
+		if engine.width != engine.height {
+			return "", errors.New("invalid number of stones")
+		}
+		points, err := HandicapPoints(engine.width, stones)
+		if err != nil || stones < 2 {
+			return "", errors.New("invalid number of stones")
+		}
+		return engine.placeHandicap(points)
+	case "set_free_handicap":
+		if game.Board.moves > 0 || len(game.Board.Tree().Root().setup) > 0 {
+			return "", errors.New("board not empty")
+		}
+		if len(args) < 2 {
+			return "", errors.New("bad vertex list")
+		}
+		points := []Position{}
+		for _, vertex := range args {
+			x, y, err := parseGTPVertex(vertex, engine.width, engine.height)
+			if err != nil || x == passCoordinate {
+				return "", errors.New("bad vertex list")
+			}
+			points = append(points, Position{x, y})
+		}
+		_, err := engine.placeHandicap(points)
+		return "", err
+	case "play":
+		if len(args) != 2 {
+			return "", errors.New("syntax error")
+		}
+		piece, err := parseGTPColor(args[0])
+		if err != nil {
+			return "", err
+		}
+		x, y, err := parseGTPVertex(args[1], engine.width, engine.height)
+		if err != nil {
+			return "", err
+		}
+		err = engine.play(&Move{x, y, piece})
+		if err != nil {
+			return "", errors.New("illegal move")
+		}
+		return "", nil
+	case "genmove":
+		if len(args) != 1 {
+			return "", errors.New("syntax error")
+		}
+		piece, err := parseGTPColor(args[0])
+		if err != nil {
+			return "", err
+		}
+		move, err := engine.bot.GenMove(game, piece)
+		if err == errResign {
+			return "resign", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		err = engine.play(move)
+		if err != nil {
+			return "", err
+		}
+		return gtpVertex(move, engine.height), nil
+	case "undo":
+		err := game.Undo()
+		if err != nil {
+			return "", errors.New("cannot undo")
+		}
+		return "", nil
+	case "showboard":
+		return "\n" + gtpBoard(game), nil
+	case "final_score":
+		return sgfResult(game.Score().Result("score")), nil
+	default:
+		return "", errors.New("unknown command")
+	}
+}
+
+// gtpBoard draws the board with the vertices of GTP, columns are letters and rows are counted from the bottom
+func gtpBoard(game *Game) string {
+	var str strings.Builder
+	width, height := game.Board.Size()
+	labelWidth := len(strconv.Itoa(height))
+	columns := strings.Repeat(" ", labelWidth+1) + strings.Join(strings.Split(gtpColumns[:width], ""), " ") + "\n"
+	str.WriteString(columns)
+	for y := 0; y < height; y++ {
+		row := height - y
+		fmt.Fprintf(&str, "%*d", labelWidth, row)
+		for x := 0; x < width; x++ {
+			piece := game.Board.data[x][y].piece
+			if piece == Empty {
+				str.WriteString(" .")
+			} else {
+				str.WriteString(" " + piece.String())
+			}
+		}
+		fmt.Fprintf(&str, " %d\n", row)
+	}
+	str.WriteString(columns)
+	captures := game.Board.Captures()
+	fmt.Fprintf(&str, "Captures: %s %d, %s %d", White, captures.White, Black, captures.Black)
+	return str.String()
+}
+
+// placeHandicap sets up handicap stones for black, and gives the turn to white
+func (engine *GTPEngine) placeHandicap(points []Position) (string, error) {
+	game := engine.game
+	vertices := []string{}
+	for _, point := range points {
+		err := game.Board.Setup(point.X, point.Y, Black)
+		if err != nil {
+			engine.clearBoard()
+			return "", errors.New("bad vertex list")
+		}
+		vertices = append(vertices, gtpVertex(&Move{point.X, point.Y, Black}, engine.height))
+	}
+	game.Handicap = len(points)
+	game.Turn = White
+	game.Board.SetStartingTurn(White)
+	return strings.Join(vertices, " "), nil
+}
+
+// play plays the move for either color, GTP doesn't require the colors to alternate
+func (engine *GTPEngine) play(move *Move) error {
+	game := engine.game
+	// Controllers keep playing after two passes, dead pieces are settled without us
+	if game.Phase == Scoring {
+		game.ResumePlay()
+	}
+	game.Turn = move.piece
+	game.handicapLeft = 0
+	_, err := game.Move(move)
+	return err
+}
+
+// parseGTPColor reads a color in the form of "b", "black", "w" or "white"
+func parseGTPColor(color string) (Piece, error) {
+	switch strings.ToLower(color) {
+	case "b", "black":
+		return Black, nil
+	case "w", "white":
+		return White, nil
+	default:
+		return Empty, errors.New("syntax error")
+	}
+}
+
+// gtpColor writes piece as "b" or "w"
+func gtpColor(piece Piece) string {
+	if piece == White {
+		return "w"
+	}
+	return "b"
+}
+
+// parseGTPVertex reads a vertex in the form of "D4" or "pass"
+// Rows are counted from the bottom in GTP, and from the top on the board
+func parseGTPVertex(vertex string, width int, height int) (int, int, error) {
+	vertex = strings.ToUpper(vertex)
+	if vertex == "PASS" {
+		return passCoordinate, passCoordinate, nil
+	}
+	if len(vertex) < 2 {
+		return 0, 0, errors.New("invalid coordinate")
+	}
+	x := strings.IndexByte(gtpColumns, vertex[0])
+	row, err := strconv.Atoi(vertex[1:])
+	if x < 0 || err != nil || x >= width || row < 1 || row > height {
+		return 0, 0, errors.New("invalid coordinate")
+	}
+	return x, height - row, nil
+}
+
+// gtpVertex writes the move in the form of "D4" or "pass"
+func gtpVertex(move *Move, height int) string {
+	if move.IsPass() {
+		return "pass"
+	}
+	return string(gtpColumns[move.x]) + strconv.Itoa(height-move.y)
+}
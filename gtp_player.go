@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// GTPPlayer plays the moves of a GTP engine running as a subprocess, such as GNU Go
+type GTPPlayer struct {
+	command *exec.Cmd
+	in      io.WriteCloser
+	out     *bufio.Reader
+	width   int
+	height  int
+	// started is set once the engine has the board of the game
+	started bool
+	// err is the last failure to tell the engine about a move, returned by the next GenMove
+	err error
+}
+
+// MakeGTPPlayer runs the engine with args as its command line
+func MakeGTPPlayer(args []string) (*GTPPlayer, error) {
+	if len(args) == 0 {
+		return nil, errors.New("GTP player should have the command of the engine")
+	}
+	command := exec.Command(args[0], args[1:]...)
+	in, err := command.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := command.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = command.Start()
+	if err != nil {
+		return nil, err
+	}
+	return &GTPPlayer{
+		command,
+		in,
+		bufio.NewReader(out),
+		0,
+		0,
+		false,
+		nil,
+	}, nil
+}
+
+// send writes a command to the engine and reads its response
+func (player *GTPPlayer) send(command string) (string, error) {
+	_, err := fmt.Fprintf(player.in, "%s\n", command)
+	if err != nil {
+		return "", err
+	}
+	lines := []string{}
+	for {
+		line, err := player.out.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" && len(lines) > 0 {
+			break
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	response := strings.Join(lines, "\n")
+	// The response starts with "=" or "?", and the id of the command which we don't send
+	text := strings.TrimSpace(response[1:])
+	if response[0] != '=' {
+		return "", fmt.Errorf("GTP engine failed %s: %s", command, text)
+	}
+	return text, nil
+}
+
+// start gives the engine the board, the komi and the moves played so far
+func (player *GTPPlayer) start(game *Game) error {
+	player.width, player.height = game.Board.Size()
+	if player.width != player.height {
+		return errors.New("GTP engines only play on square boards")
+	}
+	commands := []string{
+		fmt.Sprintf("boardsize %d", player.width),
+		"clear_board",
+		fmt.Sprintf("komi %.1f", game.Komi),
+	}
+	setup := []string{}
+	for _, move := range game.Board.Tree().Root().setup {
+		if move.piece != Black {
+			return errors.New("GTP engines only play with black handicap stones")
+		}
+		setup = append(setup, gtpVertex(move, player.height))
+	}
+	if len(setup) > 0 {
+		commands = append(commands, "set_free_handicap "+strings.Join(setup, " "))
+	}
+	for _, move := range game.Board.Tree().Moves() {
+		commands = append(commands, fmt.Sprintf("play %s %s", gtpColor(move.piece), gtpVertex(move, player.height)))
+	}
+	for _, command := range commands {
+		_, err := player.send(command)
+		if err != nil {
+			return err
+		}
+	}
+	player.started = true
+	return nil
+}
+
+// GenMove asks the engine for the move of piece
+func (player *GTPPlayer) GenMove(game *Game, piece Piece) (*Move, error) {
+	if player.err != nil {
+		return nil, player.err
+	}
+	if !player.started {
+		err := player.start(game)
+		if err != nil {
+			return nil, err
+		}
+	}
+	vertex, err := player.send("genmove " + gtpColor(piece))
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(vertex, "resign") {
+		return nil, errResign
+	}
+	x, y, err := parseGTPVertex(vertex, player.width, player.height)
+	if err != nil {
+		return nil, err
+	}
+	return &Move{x, y, piece}, nil
+}
+
+// OpponentMoved plays the move of the opponent on the board of the engine
+func (player *GTPPlayer) OpponentMoved(move *Move) {
+	if !player.started {
+		return
+	}
+	_, err := player.send(fmt.Sprintf("play %s %s", gtpColor(move.piece), gtpVertex(move, player.height)))
+	if err != nil {
+		player.err = err
+	}
+}
+
+// Undone takes back the last move on the board of the engine
+func (player *GTPPlayer) Undone() {
+	if !player.started {
+		return
+	}
+	_, err := player.send("undo")
+	if err != nil {
+		player.err = err
+	}
+}
+
+// GameOver stops the engine
+func (player *GTPPlayer) GameOver(game *Game) {
+	player.send("quit")
+	player.in.Close()
+	player.command.Wait()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// HandicapPoints are the star points handicap stones are placed on, in the standard order
+func HandicapPoints(size int, stones int) ([]Position, error) {
+	if stones < 2 {
+		return nil, errors.New("Handicap should be at least 2 stones")
+	}
+	if size < 7 {
+		return nil, fmt.Errorf("Board of size %d is too small for handicap", size)
+	}
+	maxStones := 9
+	// Boards without a center point only have the corners
+	if size%2 == 0 || size == 7 {
+		maxStones = 4
+	}
+	if stones > maxStones {
+		return nil, fmt.Errorf("Board of size %d allows up to %d handicap stones", size, maxStones)
+	}
+	edge := 2
+	if size >= 13 {
+		edge = 3
+	}
+	low, middle, high := edge, size/2, size-1-edge
+	// Corners go first, then the sides, and the center for odd numbers of stones
+	points := []Position{{high, low}, {low, high}}
+	if stones >= 3 {
+		points = append(points, Position{high, high})
+	}
+	if stones >= 4 {
+		points = append(points, Position{low, low})
+	}
+	if stones >= 6 {
+		points = append(points, Position{low, middle}, Position{high, middle})
+	}
+	if stones >= 8 {
+		points = append(points, Position{middle, low}, Position{middle, high})
+	}
+	if stones%2 == 1 && stones >= 5 {
+		points = append(points, Position{middle, middle})
+	}
+	return points, nil
+}
+
+// SetHandicap gives the first player stones before the game starts
+// Fixed handicap places them on the star points, free handicap lets the player place them
+func (game *Game) SetHandicap(stones int) error {
+	if game.Board.moves > 0 || game.Handicap > 0 {
+		return errors.New("Handicap can only be set before the game starts")
+	}
+	if stones == 0 {
+		return nil
+	}
+	if stones < 2 || stones > 9 {
+		return fmt.Errorf("Invalid handicap of %d stones, should be 2 to 9", stones)
+	}
+	switch game.Rules.Handicap {
+	case FixedHandicap:
+		width, height := game.Board.Size()
+		if width != height {
+			return errors.New("Fixed handicap is only placed on square boards")
+		}
+		points, err := HandicapPoints(width, stones)
+		if err != nil {
+			return err
+		}
+		for _, point := range points {
+			err = game.Board.Setup(point.X, point.Y, game.first)
+			if err != nil {
+				return err
+			}
+		}
+		game.Turn = game.first.Opponent()
+		err = game.Board.SetStartingTurn(game.Turn)
+		if err != nil {
+			return err
+		}
+	case FreeHandicap:
+		game.handicapLeft = stones
+	}
+	game.Handicap = stones
+	// Handicap makes up for the difference, so komi only breaks ties
+	game.Komi = 0.5
+	return nil
+}
@@ -3,33 +3,72 @@ package main
 import (
 	"fmt"
 	"math/rand"
+	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 )
 
 // GameSession has the game, and the players
 type GameSession struct {
+	// lock is held while the game or the players of the session are read or changed
+	lock      sync.Mutex
 	game      *Game
 	player1id *int
 	player2id *int
 	public    bool
+	// bot plays second when the game is against the computer
+	bot Player
 }
 
 func (session *GameSession) isReady() bool {
-	return session.player2id != nil
+	return session.player2id != nil || session.bot != nil
+}
+
+// botReply lets the bot answer the last action of the player, if the game is against the computer
+func (session *GameSession) botReply() error {
+	if session.bot == nil {
+		return nil
+	}
+	return botTurn(session.game, session.bot, session.game.FirstPlayer().Opponent(), &session.lock)
+}
+
+// sessionPiece finds which piece the session is playing
+func (session *GameSession) sessionPiece(sessionIDHeader string) (Piece, bool) {
+	sessionID, err := strconv.Atoi(sessionIDHeader)
+	if err != nil {
+		// Either expired, or not authorized, or invalid
+		return Empty, false
+	}
+	if session.player1id != nil && sessionID == *session.player1id {
+		return session.game.FirstPlayer(), true
+	}
+	if session.player2id != nil && sessionID == *session.player2id {
+		return session.game.FirstPlayer().Opponent(), true
+	}
+	return Empty, false
 }
 
 // Position defines a place on the board
 type Position struct {
-	X int `json:"x" binding:"required"`
-	Y int `json:"y" binding:"required"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// positionRequest is a position sent by a client, the pointers tell a missing coordinate from 0
+type positionRequest struct {
+	X *int `json:"x" binding:"required"`
+	Y *int `json:"y" binding:"required"`
 }
 
 // HTTPServer is a Go-in-go server in HTTP
 type HTTPServer struct {
 	port  int
 	games map[int]*GameSession
+	// lock is held while games is read or changed
+	lock sync.Mutex
 }
 
 // MakeHTTPServer creates the server
@@ -37,6 +76,7 @@ func MakeHTTPServer(port int) *HTTPServer {
 	return &HTTPServer{
 		port,
 		make(map[int]*GameSession),
+		sync.Mutex{},
 	}
 }
 
@@ -49,60 +89,102 @@ func (server *HTTPServer) start() {
 	})
 	r.POST("/game", func(c *gin.Context) {
 		gameID := 5
-		game := CreateGame(9, 4.5)
+		// The game is created from the settings, or imported from an SGF file sent as the body
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSGFSize)
+		body, err := c.GetRawData()
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": "Invalid request body",
+			})
+			return
+		}
+		var game *Game
+		if len(strings.TrimSpace(string(body))) > 0 {
+			game, err = ImportSGF(string(body))
+		} else {
+			game, err = CreateGameFromSettings(c.Request.URL.Query())
+		}
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		// "bot" chooses a built-in bot as the second player
+		var bot Player
+		if c.Query("bot") != "" {
+			bot, err = MakeBot(c.Query("bot"))
+			if err != nil {
+				c.JSON(400, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
 		sessionID := rand.Intn(10000)
 		gameSession := &GameSession{
+			sync.Mutex{},
 			game,
 			&sessionID,
 			nil,
 			false,
+			bot,
 		}
+		if gameSession.isReady() {
+			game.StartClock()
+		}
+		gameSession.lock.Lock()
+		err = gameSession.botReply()
+		gameSession.lock.Unlock()
+		if err != nil {
+			c.JSON(500, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+		server.lock.Lock()
 		server.games[gameID] = gameSession
+		server.lock.Unlock()
 		c.Header("gameID", strconv.Itoa(gameID))
 		c.Header("sessionID", strconv.Itoa(sessionID))
 		c.JSON(200, gin.H{
 			"gameID": gameID,
+			"rules":  game.PlayedRules(),
 		})
 	})
 	r.GET("/game/:id", func(c *gin.Context) {
 
 		gameIDParam := c.Param("id")
-		gameID, err := strconv.Atoi(gameIDParam)
+		// The game is downloaded as SGF from /game/:id.sgf
+		sgf := strings.HasSuffix(gameIDParam, ".sgf")
+		gameID, err := strconv.Atoi(strings.TrimSuffix(gameIDParam, ".sgf"))
 		if err != nil {
 			c.JSON(400, gin.H{
 				"message": "Invalid game ID",
 			})
 			return
 		}
-		gameSession, ok := server.games[gameID]
+		gameSession, ok := server.lockedSession(c, gameID)
 		if !ok {
-			c.JSON(404, gin.H{
-				"message": fmt.Sprintf("Game %d not found", gameID),
-			})
 			return
 		}
+		defer gameSession.lock.Unlock()
 		if !gameSession.public {
-			sessionIDHeader := c.GetHeader("sessionID")
-			sessionID, err := strconv.Atoi(sessionIDHeader)
-			if err != nil {
+			_, ok := gameSession.sessionPiece(c.GetHeader("sessionID"))
+			if !ok {
 				// Either expired, or not authorized, or invalid
 				c.JSON(404, gin.H{
 					"message": "Not allowed to access the game",
 				})
 				return
 			}
-			if !(sessionID == *gameSession.player1id || sessionID == *gameSession.player2id) {
-				c.JSON(404, gin.H{
-					"message": "Not allowed to access the game",
-				})
-				return
-			}
 		}
 
-		c.JSON(200, gin.H{
-			"turn":  gameSession.game.Turn,
-			"board": gameSession.game.Board.Pieces(),
-		})
+		if sgf {
+			c.Data(200, "application/x-go-sgf", []byte(gameSession.game.SGF()))
+			return
+		}
+		c.JSON(200, gameSession.game)
 	})
 	r.POST("/game/:id", func(c *gin.Context) {
 		gameIDParam := c.Param("id")
@@ -113,13 +195,11 @@ func (server *HTTPServer) start() {
 			})
 			return
 		}
-		gameSession, ok := server.games[gameID]
+		gameSession, ok := server.lockedSession(c, gameID)
 		if !ok {
-			c.JSON(404, gin.H{
-				"message": fmt.Sprintf("Game %d not found", gameID),
-			})
 			return
 		}
+		defer gameSession.lock.Unlock()
 		if gameSession.isReady() {
 			c.JSON(400, gin.H{
 				"message": "Game has already started",
@@ -128,75 +208,377 @@ func (server *HTTPServer) start() {
 		}
 		sessionID := rand.Intn(10000)
 		gameSession.player2id = &sessionID
+		gameSession.game.StartClock()
 		c.Header("sessionID", strconv.Itoa(sessionID))
-		c.JSON(200, gin.H{
-			"turn":  gameSession.game.Turn.String(),
-			"board": gameSession.game.Board.Pieces(),
-		})
+		c.JSON(200, gameSession.game)
 	})
 
 	r.POST("/game/:id/move", func(c *gin.Context) {
-		gameIDParam := c.Param("id")
-		gameID, err := strconv.Atoi(gameIDParam)
+		gameSession, ok := server.playerSession(c)
+		if !ok {
+			return
+		}
+		defer gameSession.lock.Unlock()
+		position, ok := bindPosition(c)
+		if !ok {
+			return
+		}
+		move := &Move{position.X, position.Y, gameSession.game.Turn}
+		_, err := gameSession.game.Move(move)
+		respondMove(c, gameSession, err)
+	})
+	r.POST("/game/:id/pass", func(c *gin.Context) {
+		gameSession, ok := server.playerSession(c)
+		if !ok {
+			return
+		}
+		defer gameSession.lock.Unlock()
+		_, err := gameSession.game.Pass()
+		respondMove(c, gameSession, err)
+	})
+	r.POST("/game/:id/resign", func(c *gin.Context) {
+		gameSession, piece, ok := server.memberSession(c)
+		if !ok {
+			return
+		}
+		defer gameSession.lock.Unlock()
+		err := gameSession.game.Resign(piece)
+		respondMove(c, gameSession, err)
+	})
+	r.POST("/game/:id/dead", func(c *gin.Context) {
+		gameSession, _, ok := server.memberSession(c)
+		if !ok {
+			return
+		}
+		defer gameSession.lock.Unlock()
+		position, ok := bindPosition(c)
+		if !ok {
+			return
+		}
+		err := gameSession.game.ToggleDead(position.X, position.Y)
+		respondMove(c, gameSession, err)
+	})
+	r.POST("/game/:id/accept", func(c *gin.Context) {
+		gameSession, piece, ok := server.memberSession(c)
+		if !ok {
+			return
+		}
+		defer gameSession.lock.Unlock()
+		_, err := gameSession.game.AcceptScore(piece)
+		respondMove(c, gameSession, err)
+	})
+	r.POST("/game/:id/resume", func(c *gin.Context) {
+		gameSession, _, ok := server.memberSession(c)
+		if !ok {
+			return
+		}
+		defer gameSession.lock.Unlock()
+		err := gameSession.game.ResumePlay()
+		respondMove(c, gameSession, err)
+	})
+	r.POST("/game/:id/undo", func(c *gin.Context) {
+		gameSession, piece, ok := server.memberSession(c)
+		if !ok {
+			return
+		}
+		defer gameSession.lock.Unlock()
+		err := gameSession.game.RequestUndo(piece)
+		respondMove(c, gameSession, err)
+	})
+	r.POST("/game/:id/undo/accept", func(c *gin.Context) {
+		gameSession, piece, ok := server.memberSession(c)
+		if !ok {
+			return
+		}
+		defer gameSession.lock.Unlock()
+		err := gameSession.game.AcceptUndo(piece)
+		respondMove(c, gameSession, err)
+	})
+	r.POST("/game/:id/undo/decline", func(c *gin.Context) {
+		gameSession, piece, ok := server.memberSession(c)
+		if !ok {
+			return
+		}
+		defer gameSession.lock.Unlock()
+		err := gameSession.game.DeclineUndo(piece)
+		respondMove(c, gameSession, err)
+	})
+
+	r.GET("/game/:id/tree", func(c *gin.Context) {
+		gameSession, _, ok := server.memberSession(c)
+		if !ok {
+			return
+		}
+		defer gameSession.lock.Unlock()
+		tree := gameSession.game.Board.Tree()
+		c.JSON(200, gin.H{
+			"node": tree.Current().ID(),
+			"tree": tree.Root(),
+		})
+	})
+	// The chain at ?x=&y= is shown with its liberties, so clients can point out groups in atari
+	r.GET("/game/:id/chain", func(c *gin.Context) {
+		gameSession, _, ok := server.memberSession(c)
+		if !ok {
+			return
+		}
+		defer gameSession.lock.Unlock()
+		x, errX := strconv.Atoi(c.Query("x"))
+		y, errY := strconv.Atoi(c.Query("y"))
+		if errX != nil || errY != nil {
+			c.JSON(400, gin.H{
+				"message": "Invalid request: should have 'x' and 'y'",
+			})
+			return
+		}
+		chain, err := gameSession.game.Board.Chain(x, y)
 		if err != nil {
 			c.JSON(400, gin.H{
-				"message": "Invalid game ID",
+				"message": err.Error(),
 			})
 			return
 		}
-		gameSession, ok := server.games[gameID]
+		c.JSON(200, chain)
+	})
+	r.POST("/game/:id/review", func(c *gin.Context) {
+		gameSession, _, ok := server.memberSession(c)
+		if !ok {
+			return
+		}
+		defer gameSession.lock.Unlock()
+		err := gameSession.game.Review()
+		respondMove(c, gameSession, err)
+	})
+	r.POST("/game/:id/review/next", func(c *gin.Context) {
+		gameSession, _, ok := server.memberSession(c)
 		if !ok {
-			c.JSON(404, gin.H{
-				"message": fmt.Sprintf("Game %d not found", gameID),
+			return
+		}
+		defer gameSession.lock.Unlock()
+		request := struct {
+			Variation int `json:"variation"`
+		}{}
+		err := c.ShouldBindJSON(&request)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": "Invalid request: should have 'variation'",
 			})
 			return
 		}
-
-		sessionIDHeader := c.GetHeader("sessionID")
-		sessionID, err := strconv.Atoi(sessionIDHeader)
+		_, err = gameSession.game.Next(request.Variation)
+		respondMove(c, gameSession, err)
+	})
+	r.POST("/game/:id/review/previous", func(c *gin.Context) {
+		gameSession, _, ok := server.memberSession(c)
+		if !ok {
+			return
+		}
+		defer gameSession.lock.Unlock()
+		err := gameSession.game.Previous()
+		respondMove(c, gameSession, err)
+	})
+	r.POST("/game/:id/review/variation", func(c *gin.Context) {
+		gameSession, _, ok := server.memberSession(c)
+		if !ok {
+			return
+		}
+		defer gameSession.lock.Unlock()
+		request := struct {
+			Variation int `json:"variation"`
+		}{}
+		err := c.ShouldBindJSON(&request)
 		if err != nil {
-			// Either expired, or not authorized, or invalid
-			c.JSON(404, gin.H{
-				"message": "Not allowed to access the game",
+			c.JSON(400, gin.H{
+				"message": "Invalid request: should have 'variation'",
 			})
 			return
 		}
-		if gameSession.game.Turn == White {
-			if sessionID != *gameSession.player1id {
-				c.JSON(400, gin.H{
-					"message": "It's white player turn",
-				})
-				return
-			}
-		} else {
-			if sessionID != *gameSession.player2id {
-				c.JSON(400, gin.H{
-					"message": "It's black player turn",
-				})
-				return
-			}
+		err = gameSession.game.SwitchVariation(request.Variation)
+		respondMove(c, gameSession, err)
+	})
+	r.POST("/game/:id/review/goto", func(c *gin.Context) {
+		gameSession, _, ok := server.memberSession(c)
+		if !ok {
+			return
 		}
-		position := Position{}
-		err = c.ShouldBindJSON(&position)
+		defer gameSession.lock.Unlock()
+		request := struct {
+			Node int `json:"node"`
+		}{}
+		err := c.ShouldBindJSON(&request)
 		if err != nil {
 			c.JSON(400, gin.H{
-				"message": "Invalid request: should have 'x' and 'y'",
+				"message": "Invalid request: should have 'node'",
 			})
 			return
 		}
-		move := &Move{position.X, position.Y, gameSession.game.Turn}
-		result, err := gameSession.game.Move(move)
-		if result != Ok {
+		err = gameSession.game.GoTo(request.Node)
+		respondMove(c, gameSession, err)
+	})
+	r.POST("/game/:id/comment", func(c *gin.Context) {
+		gameSession, _, ok := server.memberSession(c)
+		if !ok {
+			return
+		}
+		defer gameSession.lock.Unlock()
+		request := struct {
+			Text string `json:"text"`
+		}{}
+		err := c.ShouldBindJSON(&request)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": "Invalid request: should have 'text'",
+			})
+			return
+		}
+		gameSession.game.Comment(request.Text)
+		respondMove(c, gameSession, nil)
+	})
+	r.POST("/game/:id/mark", func(c *gin.Context) {
+		gameSession, _, ok := server.memberSession(c)
+		if !ok {
+			return
+		}
+		defer gameSession.lock.Unlock()
+		data, err := c.GetRawData()
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": "Invalid request: should have 'x', 'y' and 'shape'",
+			})
+			return
+		}
+		mark, err := ParseMark(data)
+		if err != nil {
 			c.JSON(400, gin.H{
 				"message": err.Error(),
 			})
 			return
 		}
-		c.JSON(200, gin.H{
-			"turn":  gameSession.game.Turn,
-			"board": gameSession.game.Board.Pieces(),
-		})
+		err = gameSession.game.Mark(*mark)
+		respondMove(c, gameSession, err)
+	})
+	r.DELETE("/game/:id/mark", func(c *gin.Context) {
+		gameSession, _, ok := server.memberSession(c)
+		if !ok {
+			return
+		}
+		defer gameSession.lock.Unlock()
+		position, ok := bindPosition(c)
+		if !ok {
+			return
+		}
+		err := gameSession.game.Unmark(position.X, position.Y)
+		respondMove(c, gameSession, err)
 	})
 
 	r.Run(fmt.Sprintf(":%d", server.port))
 }
+
+// lockedSession finds the game with gameID and locks its session, the caller unlocks it
+// A player who stopped playing loses on time before anything else happens
+// Responds with an error and returns false when the game isn't found
+func (server *HTTPServer) lockedSession(c *gin.Context, gameID int) (*GameSession, bool) {
+	server.lock.Lock()
+	gameSession, ok := server.games[gameID]
+	server.lock.Unlock()
+	if !ok {
+		c.JSON(404, gin.H{
+			"message": fmt.Sprintf("Game %d not found", gameID),
+		})
+		return nil, false
+	}
+	gameSession.lock.Lock()
+	gameSession.game.CheckTime()
+	return gameSession, true
+}
+
+// playerSession finds the requested game and checks it's the turn of the requesting player
+// The session is returned locked, the caller unlocks it
+// Responds with an error and returns false otherwise
+func (server *HTTPServer) playerSession(c *gin.Context) (*GameSession, bool) {
+	gameIDParam := c.Param("id")
+	gameID, err := strconv.Atoi(gameIDParam)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"message": "Invalid game ID",
+		})
+		return nil, false
+	}
+	gameSession, ok := server.lockedSession(c, gameID)
+	if !ok {
+		return nil, false
+	}
+	piece, ok := gameSession.sessionPiece(c.GetHeader("sessionID"))
+	if !ok {
+		gameSession.lock.Unlock()
+		// Either expired, or not authorized, or invalid
+		c.JSON(404, gin.H{
+			"message": "Not allowed to access the game",
+		})
+		return nil, false
+	}
+	if piece != gameSession.game.Turn {
+		gameSession.lock.Unlock()
+		c.JSON(400, gin.H{
+			"message": fmt.Sprintf("It's %s player turn", strings.ToLower(gameSession.game.Turn.Name())),
+		})
+		return nil, false
+	}
+	return gameSession, true
+}
+
+// memberSession finds the requested game and which piece the requesting player plays
+// The session is returned locked, the caller unlocks it
+// Responds with an error and returns false otherwise
+func (server *HTTPServer) memberSession(c *gin.Context) (*GameSession, Piece, bool) {
+	gameIDParam := c.Param("id")
+	gameID, err := strconv.Atoi(gameIDParam)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"message": "Invalid game ID",
+		})
+		return nil, Empty, false
+	}
+	gameSession, ok := server.lockedSession(c, gameID)
+	if !ok {
+		return nil, Empty, false
+	}
+	piece, ok := gameSession.sessionPiece(c.GetHeader("sessionID"))
+	if !ok {
+		gameSession.lock.Unlock()
+		c.JSON(404, gin.H{
+			"message": "Not allowed to access the game",
+		})
+		return nil, Empty, false
+	}
+	return gameSession, piece, true
+}
+
+// bindPosition reads the position in the body of the request
+// Responds with an error and returns false when a coordinate is missing
+func bindPosition(c *gin.Context) (Position, bool) {
+	request := positionRequest{}
+	err := c.ShouldBindJSON(&request)
+	if err != nil || request.X == nil || request.Y == nil {
+		c.JSON(400, gin.H{
+			"message": "Invalid request: should have 'x' and 'y'",
+		})
+		return Position{}, false
+	}
+	return Position{*request.X, *request.Y}, true
+}
+
+// respondMove writes the state of the game after a move or reports why it failed
+// Games against the computer get the reply of the bot first
+func respondMove(c *gin.Context, gameSession *GameSession, err error) {
+	if err == nil {
+		err = gameSession.botReply()
+	}
+	if err != nil {
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gameSession.game)
+}
@@ -1,6 +1,116 @@
 package main
 
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "gtp":
+			// "gtp <bot>" chooses the bot answering genmove
+			bot, err := MakeBot(argument(2, "random"))
+			if err == nil {
+				err = MakeGTPEngine(bot).ServeGTP(os.Stdin, os.Stdout)
+			}
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			return
+		case "tcp":
+			// "tcp gtp <bot>" serves GTP instead of games between two players, with the bot answering genmove
+			server := &TcpServer{9060, argument(2, "") == "gtp", argument(3, "random")}
+			server.start()
+			return
+		case "play":
+			// "play <black> <white> <settings>" plays on the terminal, players are human or bots
+			err := play(argument(2, "human"), argument(3, "human"), argument(4, ""))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			return
+		case "arena":
+			// "arena <first> <second> <games> <settings> <directory>" compares two players, and keeps the SGFs in directory
+			err := runArena(argument(2, "random"), argument(3, "random"), argument(4, "10"), argument(5, ""), argument(6, ""))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
 	server := MakeSocketIOServer(9070)
 	server.Start()
 }
+
+// argument is the command line argument at index, or fallback when it's missing
+func argument(index int, fallback string) string {
+	if len(os.Args) > index {
+		return os.Args[index]
+	}
+	return fallback
+}
+
+// play runs a game on the terminal between the named players
+// Settings are written like a query string, e.g. "size=9&rules=japanese"
+func play(blackName string, whiteName string, settings string) error {
+	values, err := url.ParseQuery(settings)
+	if err != nil {
+		return err
+	}
+	game, err := CreateGameFromSettings(values)
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReader(os.Stdin)
+	black, err := MakePlayer(blackName, reader, os.Stdout)
+	if err != nil {
+		return err
+	}
+	white := black
+	// Humans sharing the terminal are the same player
+	if !strings.EqualFold(blackName, "human") || !strings.EqualFold(whiteName, "human") {
+		white, err = MakePlayer(whiteName, reader, os.Stdout)
+		if err != nil {
+			return err
+		}
+	}
+	err = game.Start(black, white)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// Humans are shown the result by their player
+	_, blackHuman := black.(*HumanPlayer)
+	_, whiteHuman := white.(*HumanPlayer)
+	if !blackHuman && !whiteHuman {
+		fmt.Print(game.Board.String(false))
+		fmt.Printf("%s\n", game.Result)
+	}
+	return nil
+}
+
+// runArena plays games between the named players and prints the win rates
+func runArena(first string, second string, games string, settings string, directory string) error {
+	count, err := strconv.Atoi(games)
+	if err != nil {
+		return errors.New("Invalid number of games: should be a number")
+	}
+	arena, err := MakeArena(first, second, count, settings, directory)
+	if err != nil {
+		return err
+	}
+	_, err = arena.Run(os.Stdout)
+	return err
+}
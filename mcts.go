@@ -0,0 +1,335 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net/url"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limits of the settings of the MCTS bot, so servers can't be asked to think forever
+const (
+	maxPlayouts  = 1000000
+	maxThinkTime = time.Minute
+)
+
+// mctsResignRate is the win rate of the best move under which the MCTS bot resigns
+const mctsResignRate = 0.05
+
+// MCTSPlayer is a bot searching the moves with Monte Carlo Tree Search (UCT)
+// Every worker grows its own tree from random playouts on bitboards, and their visits are added up
+type MCTSPlayer struct {
+	// playouts is the number of playouts for every move, shared by the workers
+	playouts int
+	// budget is the longest time spent on a move
+	budget  time.Duration
+	workers int
+	// exploration is the UCT constant, higher values try the less visited moves more
+	exploration float64
+	seed        int64
+}
+
+// MakeMCTSPlayer creates a bot thinking for up to playouts playouts or budget time, whichever comes first
+func MakeMCTSPlayer(playouts int, budget time.Duration, workers int) *MCTSPlayer {
+	return &MCTSPlayer{
+		playouts,
+		budget,
+		workers,
+		1.4,
+		time.Now().UnixNano(),
+	}
+}
+
+// ParseMCTSPlayer creates a bot from settings written like a query string, e.g. "playouts=5000&time=2s&workers=4"
+// Missing settings are 2000 playouts, 5 seconds and a worker for every CPU
+func ParseMCTSPlayer(settings string) (*MCTSPlayer, error) {
+	values, err := url.ParseQuery(settings)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid MCTS settings: %s", err)
+	}
+	player := MakeMCTSPlayer(2000, 5*time.Second, runtime.NumCPU())
+	if values.Get("playouts") != "" {
+		player.playouts, err = strconv.Atoi(values.Get("playouts"))
+		if err != nil || player.playouts < 1 || player.playouts > maxPlayouts {
+			return nil, fmt.Errorf("Invalid playouts: should be 1 to %d", maxPlayouts)
+		}
+	}
+	if values.Get("time") != "" {
+		player.budget, err = time.ParseDuration(values.Get("time"))
+		if err != nil || player.budget <= 0 || player.budget > maxThinkTime {
+			return nil, fmt.Errorf("Invalid time: should be a duration such as 2s, up to %s", maxThinkTime)
+		}
+	}
+	if values.Get("workers") != "" {
+		player.workers, err = strconv.Atoi(values.Get("workers"))
+		if err != nil || player.workers < 1 || player.workers > runtime.NumCPU() {
+			return nil, fmt.Errorf("Invalid workers: should be 1 to %d", runtime.NumCPU())
+		}
+	}
+	return player, nil
+}
+
+// mctsNode is a move in the search tree, with the playouts which went through it
+type mctsNode struct {
+	move     Move
+	parent   *mctsNode
+	children []*mctsNode
+	// untried are the moves after this one which don't have a node yet
+	untried []Move
+	visits  float64
+	// wins are the playouts won by the piece of the move
+	wins float64
+}
+
+// mctsSearch is the tree of a worker, and what it needs to play out the moves
+type mctsSearch struct {
+	root  *mctsNode
+	board *BitBoard
+	komi  float32
+	first Piece
+	// exploration is the UCT constant of the player
+	exploration float64
+	random      *rand.Rand
+	// empty is reused to list the empty cells of the board
+	empty []int
+}
+
+// GenMove searches the moves of piece and plays the most visited one
+// It passes after the opponent when it's already winning, and resigns when it has almost no chance
+func (player *MCTSPlayer) GenMove(game *Game, piece Piece) (*Move, error) {
+	return player.snapshot(game, piece)()
+}
+
+// snapshot copies the position, the komi and the time left to piece, the search runs on the copy only
+func (player *MCTSPlayer) snapshot(game *Game, piece Piece) func() (*Move, error) {
+	moves := game.Board.Tree().Moves()
+	if len(moves) > 0 && moves[len(moves)-1].IsPass() && game.AreaScore().Result("score").Outcome.Winner() == piece {
+		return func() (*Move, error) {
+			return MakePass(piece), nil
+		}
+	}
+	board := game.Board.BitBoard()
+	budget := player.budget
+	if game.Clock != nil {
+		// The time left is shared by the moves of about half the empty cells
+		if moveTime := game.Clock.MoveTime(piece, board.empty().count()/2); moveTime < budget {
+			budget = moveTime
+		}
+	}
+	komi, first := game.Komi, game.first
+	return func() (*Move, error) {
+		return player.search(board, piece, komi, first, budget)
+	}
+}
+
+// search plays out the moves of piece from board for up to the budget, and picks the most visited one
+func (player *MCTSPlayer) search(board *BitBoard, piece Piece, komi float32, first Piece, budget time.Duration) (*Move, error) {
+	deadline := time.Now().Add(budget)
+	searches := make([]*mctsSearch, player.workers)
+	var wait sync.WaitGroup
+	for i := range searches {
+		searches[i] = &mctsSearch{
+			&mctsNode{*MakePass(piece.Opponent()), nil, nil, nil, 0, 0},
+			board,
+			komi,
+			first,
+			player.exploration,
+			rand.New(rand.NewSource(player.seed + int64(i))),
+			make([]int, 0, board.width*board.height),
+		}
+		searches[i].root.untried = searches[i].candidates(board, piece)
+		playouts := player.playouts / player.workers
+		if i < player.playouts%player.workers {
+			playouts++
+		}
+		wait.Add(1)
+		go func(search *mctsSearch, playouts int) {
+			defer wait.Done()
+			search.run(playouts, deadline)
+		}(searches[i], playouts)
+	}
+	wait.Wait()
+	player.seed += int64(player.workers)
+
+	// The visits of the same move are added up over the workers
+	visits := map[Move]float64{}
+	wins := map[Move]float64{}
+	for _, search := range searches {
+		for _, child := range search.root.children {
+			visits[child.move] += child.visits
+			wins[child.move] += child.wins
+		}
+	}
+	var best *Move
+	for move := range visits {
+		if best == nil || visits[move] > visits[*best] || visits[move] == visits[*best] && move.x*board.height+move.y < best.x*board.height+best.y {
+			chosen := move
+			best = &chosen
+		}
+	}
+	if best == nil {
+		return MakePass(piece), nil
+	}
+	if visits[*best] >= 100 && wins[*best]/visits[*best] < mctsResignRate {
+		return nil, errResign
+	}
+	return best, nil
+}
+
+func (player *MCTSPlayer) OpponentMoved(move *Move) {
+}
+
+func (player *MCTSPlayer) Undone() {
+}
+
+func (player *MCTSPlayer) GameOver(game *Game) {
+}
+
+// run grows the tree until it did playouts playouts or the deadline passed
+func (search *mctsSearch) run(playouts int, deadline time.Time) {
+	for i := 0; i < playouts; i++ {
+		// Checking the time is slower than a playout on small boards
+		if i%16 == 0 && time.Now().After(deadline) {
+			return
+		}
+		board := search.board.Clone()
+		node := search.root
+		// Selection: follow the best child while the node has no untried move
+		for len(node.untried) == 0 && len(node.children) > 0 {
+			node = search.selectChild(node)
+			board.Move(&node.move)
+		}
+		// Expansion: add a node for one untried move which is legal
+		for len(node.untried) > 0 {
+			last := len(node.untried) - 1
+			pick := search.random.Intn(len(node.untried))
+			move := node.untried[pick]
+			node.untried[pick] = node.untried[last]
+			node.untried = node.untried[:last]
+			if board.Move(&move) != nil {
+				continue
+			}
+			child := &mctsNode{move, node, nil, search.candidates(board, move.piece.Opponent()), 0, 0}
+			node.children = append(node.children, child)
+			node = child
+			break
+		}
+		// Simulation, then backpropagation of the winner to the nodes of the path
+		winner := search.playout(board, node.move.piece.Opponent())
+		for ; node != nil; node = node.parent {
+			node.visits++
+			if node.move.piece == winner {
+				node.wins++
+			}
+		}
+	}
+}
+
+// selectChild picks the child with the best upper confidence bound
+func (search *mctsSearch) selectChild(node *mctsNode) *mctsNode {
+	var best *mctsNode
+	bestValue := math.Inf(-1)
+	logVisits := math.Log(node.visits)
+	for _, child := range node.children {
+		value := child.wins/child.visits + search.exploration*math.Sqrt(logVisits/child.visits)
+		if value > bestValue {
+			best, bestValue = child, value
+		}
+	}
+	return best
+}
+
+// candidates are the moves of piece worth trying: empty cells which aren't its own eyes, or a pass when there's none
+// Legality is only checked when the move is tried
+func (search *mctsSearch) candidates(board *BitBoard, piece Piece) []Move {
+	moves := []Move{}
+	empty := board.empty()
+	for x := 0; x < board.width; x++ {
+		for y := 0; y < board.height; y++ {
+			i := board.index(x, y)
+			if empty.has(i) && !board.isEye(i, piece) {
+				moves = append(moves, Move{x, y, piece})
+			}
+		}
+	}
+	if len(moves) == 0 {
+		moves = append(moves, *MakePass(piece))
+	}
+	return moves
+}
+
+// playout plays random moves which don't fill eyes until both players pass, and returns the winner
+func (search *mctsSearch) playout(board *BitBoard, turn Piece) Piece {
+	passes := 0
+	for moves := 0; moves < board.width*board.height*3 && passes < 2; moves++ {
+		search.empty = search.empty[:0]
+		empty := board.empty()
+		for x := 0; x < board.width; x++ {
+			for y := 0; y < board.height; y++ {
+				if i := board.index(x, y); empty.has(i) {
+					search.empty = append(search.empty, i)
+				}
+			}
+		}
+		played := false
+		// Try the empty cells in a random order until one is a legal move
+		for left := len(search.empty); left > 0 && !played; left-- {
+			pick := search.random.Intn(left)
+			i := search.empty[pick]
+			search.empty[pick] = search.empty[left-1]
+			if board.isEye(i, turn) {
+				continue
+			}
+			move := Move{i % board.stride, i / board.stride, turn}
+			played = board.Move(&move) == nil
+		}
+		if played {
+			passes = 0
+		} else {
+			board.Move(MakePass(turn))
+			passes++
+		}
+		turn = turn.Opponent()
+	}
+	score := board.areaScore()
+	score.Add(search.first.Opponent(), search.komi)
+	return score.Result("score").Outcome.Winner()
+}
+
+// isEye checks if the empty cell i is an eye of piece, like isEye for the bots on boards
+func (board *BitBoard) isEye(i int, piece Piece) bool {
+	stride := board.stride
+	for _, neighbour := range [...]int{i - 1, i + 1, i - stride, i + stride} {
+		if neighbour >= 0 && board.onBoard.has(neighbour) && !board.stones[piece].has(neighbour) {
+			return false
+		}
+	}
+	opponents := 0
+	edge := false
+	for _, diagonal := range [...]int{i - stride - 1, i - stride + 1, i + stride - 1, i + stride + 1} {
+		if diagonal < 0 || !board.onBoard.has(diagonal) {
+			edge = true
+			continue
+		}
+		if board.stones[piece.Opponent()].has(diagonal) {
+			opponents++
+		}
+	}
+	return eyeDiagonals(opponents, edge)
+}
+
+// areaScore counts the pieces of each color and the empty cells only next to one color, without komi
+// Playouts fill everything but eyes, so regions don't need to be searched
+func (board *BitBoard) areaScore() Score {
+	score := Score{float32(board.stones[White].count()), float32(board.stones[Black].count())}
+	empty := board.empty()
+	whiteNeighbours := board.dilate(board.stones[White])
+	blackNeighbours := board.dilate(board.stones[Black])
+	score.Add(White, float32(empty.and(whiteNeighbours).andNot(blackNeighbours).count()))
+	score.Add(Black, float32(empty.and(blackNeighbours).andNot(whiteNeighbours).count()))
+	return score
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Player chooses the moves of one color in a game driven by Game.Start
+type Player interface {
+	// GenMove chooses the move of piece, it's the turn of piece in game
+	GenMove(game *Game, piece Piece) (*Move, error)
+	// OpponentMoved is told about every move of the other player
+	OpponentMoved(move *Move)
+	// Undone is told about every move taken back, of either player
+	Undone()
+	// GameOver is told once the game has a result
+	GameOver(game *Game)
+}
+
+// errResign is returned by GenMove when the player gives up
+var errResign = errors.New("Resigned")
+
+// errUndo is returned by GenMove when the player takes back its last move
+var errUndo = errors.New("Undo")
+
+// MakePlayer creates a player by name: "human", a bot made by MakeBot,
+// or "gtp:" followed by the command running a GTP engine
+// Human players read their moves from reader and see the board on out
+func MakePlayer(name string, reader *bufio.Reader, out io.Writer) (Player, error) {
+	if strings.HasPrefix(name, "gtp:") {
+		return MakeGTPPlayer(strings.Fields(strings.TrimPrefix(name, "gtp:")))
+	}
+	if strings.EqualFold(name, "human") {
+		return &HumanPlayer{reader, out}, nil
+	}
+	return MakeBot(name)
+}
+
+// HumanPlayer asks for moves on a terminal
+type HumanPlayer struct {
+	reader *bufio.Reader
+	out    io.Writer
+}
+
+// GenMove shows the board and reads "x y", "pass", "undo" or "resign"
+func (player *HumanPlayer) GenMove(game *Game, piece Piece) (*Move, error) {
+	fmt.Fprint(player.out, game.Board.String(false))
+	if game.Clock != nil {
+		fmt.Fprintf(player.out, "%s\n", game.Clock)
+	}
+	fmt.Fprintf(player.out, "%s's turn: ", piece)
+	line, err := player.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "undo":
+		return nil, errUndo
+	case "resign":
+		return nil, errResign
+	}
+	return ParseMove(line, piece)
+}
+
+// OpponentMoved shows the move of the opponent
+func (player *HumanPlayer) OpponentMoved(move *Move) {
+	fmt.Fprintf(player.out, "%s\n", move)
+}
+
+// Undone doesn't need to do anything, the board is shown before every move
+func (player *HumanPlayer) Undone() {
+}
+
+// GameOver shows the final board and the result
+func (player *HumanPlayer) GameOver(game *Game) {
+	fmt.Fprint(player.out, game.Board.String(false))
+	fmt.Fprintf(player.out, "Game over\n")
+	if game.Result != nil {
+		fmt.Fprintf(player.out, "%s\n", game.Result)
+	}
+}
@@ -1,68 +1,87 @@
 package main
 
 import (
-	"strings"
+	"errors"
 )
 
-type MovementQueue struct {
-	data []*Move
-	head *Move
-}
-
-func MakeMovementQueue() *MovementQueue {
-	return &MovementQueue{
-		[]*Move{},
-		nil,
-	}
-}
-
-func (queue *MovementQueue) String() string {
-	var str strings.Builder
-
-	for i := 0; i < len(queue.data); i++ {
-		str.WriteString(queue.data[i].String() + "\n")
-	}
-
-	return str.String()
-}
-
-// Queue is FIFO
-func (queue *MovementQueue) Enqueue(move *Move) error {
-	queue.data = append(queue.data, move)
-	queue.head = move
-	return nil
-}
-
 type BoardQueue struct {
 	data []*Grid
 	head *Grid
+	// hashes are the zobrist hashes of every position in data
+	hashes []uint64
+	// next are the pieces to move after every position in data
+	next []Piece
+	// captures are the prisoners each color had at every position in data
+	captures     []Captures
+	headHash     uint64
+	headCaptures Captures
 }
 
 func MakeBoardQueue() *BoardQueue {
 	return &BoardQueue{
 		[]*Grid{},
 		nil,
+		[]uint64{},
+		[]Piece{},
+		[]Captures{},
+		0,
+		Captures{},
 	}
 }
 
-func (queue *BoardQueue) Enqueue(board *Grid) error {
+func (queue *BoardQueue) Enqueue(board *Grid, hash uint64, next Piece, captures Captures) error {
 	// Make a snapshot of the grid to store as history
 	snapshot := board.Clone()
 	queue.data = append(queue.data, &snapshot)
 	queue.head = &snapshot
+	queue.hashes = append(queue.hashes, hash)
+	queue.next = append(queue.next, next)
+	queue.captures = append(queue.captures, captures)
+	queue.headHash = hash
+	queue.headCaptures = captures
+	return nil
+}
+
+// Pop removes the last position, for undo
+// The first position is kept, as it's the board the game started from
+func (queue *BoardQueue) Pop() error {
+	last := len(queue.data) - 1
+	if last < 1 {
+		return errors.New("No positions to undo")
+	}
+	queue.data = queue.data[:last]
+	queue.hashes = queue.hashes[:last]
+	queue.next = queue.next[:last]
+	queue.captures = queue.captures[:last]
+	queue.head = queue.data[last-1]
+	queue.headHash = queue.hashes[last-1]
+	queue.headCaptures = queue.captures[last-1]
 	return nil
 }
 
-func (queue *BoardQueue) IsKo(board *Grid) bool {
-	// Ko is when move n == n-2
-	currentBoard := *board
-	previousBoard := *queue.data[len(queue.data)-2]
-	for i := 0; i < len(currentBoard); i++ {
-		for y := 0; y < len(currentBoard); y++ {
-			if currentBoard[i][y].piece != previousBoard[i][y].piece {
-				return false
+// IsKo checks if the position with hash, with next to move, repeats a position forbidden by rule
+func (queue *BoardQueue) IsKo(hash uint64, next Piece, rule KoRule) bool {
+	switch rule {
+	case PositionalSuperko:
+		for i := range queue.hashes {
+			if queue.hashes[i] == hash {
+				return true
 			}
 		}
+		return false
+	case SituationalSuperko:
+		situation := hash ^ zobristTurn[next]
+		for i := range queue.hashes {
+			if queue.hashes[i]^zobristTurn[queue.next[i]] == situation {
+				return true
+			}
+		}
+		return false
+	default:
+		// Ko is when move n == n-2
+		if len(queue.hashes) < 2 {
+			return false
+		}
+		return queue.hashes[len(queue.hashes)-2] == hash
 	}
-	return true
 }
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// referenceBoard is a naive board used to check Board and BitBoard against
+// It copies the whole position and flood fills groups on every move
+type referenceBoard struct {
+	width    int
+	height   int
+	pieces   [][]Piece
+	rules    Rules
+	captures Captures
+	// history has every position, and the piece to move after it
+	history []string
+	next    []Piece
+}
+
+// makeReferenceBoard creates an empty board, where first moves first
+func makeReferenceBoard(width int, height int, rules Rules, first Piece) *referenceBoard {
+	pieces := make([][]Piece, width)
+	for x := range pieces {
+		pieces[x] = make([]Piece, height)
+	}
+	board := &referenceBoard{width, height, pieces, rules, Captures{}, nil, nil}
+	board.history = []string{board.key(pieces)}
+	board.next = []Piece{first}
+	return board
+}
+
+func (board *referenceBoard) key(pieces [][]Piece) string {
+	key := make([]byte, 0, board.width*board.height)
+	for x := range pieces {
+		for y := range pieces[x] {
+			key = append(key, pieces[x][y].String()[0])
+		}
+	}
+	return string(key)
+}
+
+// matches checks the pieces are the same as the position of the board
+func (board *referenceBoard) matches(pieces [][]string) bool {
+	for x := range board.pieces {
+		for y := range board.pieces[x] {
+			if pieces[x][y] != board.pieces[x][y].String() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// group flood fills the pieces connected to (x, y), and checks if any of them has a liberty
+func (board *referenceBoard) group(pieces [][]Piece, x int, y int) ([]Position, bool) {
+	piece := pieces[x][y]
+	visited := map[Position]bool{{x, y}: true}
+	stack := []Position{{x, y}}
+	group := []Position{}
+	liberty := false
+	for len(stack) > 0 {
+		stone := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		group = append(group, stone)
+		for i := range cellOffsets {
+			newX, newY := stone.X+cellOffsets[i][0], stone.Y+cellOffsets[i][1]
+			if newX < 0 || newX >= board.width || newY < 0 || newY >= board.height {
+				continue
+			}
+			neighbour := Position{newX, newY}
+			if pieces[newX][newY] == Empty {
+				liberty = true
+			} else if pieces[newX][newY] == piece && !visited[neighbour] {
+				visited[neighbour] = true
+				stack = append(stack, neighbour)
+			}
+		}
+	}
+	return group, liberty
+}
+
+// Move plays the move on a copy of the position, which replaces the board if the move is legal
+func (board *referenceBoard) Move(move *Move) bool {
+	if move.IsPass() {
+		board.history = append(board.history, board.key(board.pieces))
+		board.next = append(board.next, move.piece.Opponent())
+		return true
+	}
+	if move.x < 0 || move.x >= board.width || move.y < 0 || move.y >= board.height || board.pieces[move.x][move.y] != Empty {
+		return false
+	}
+	pieces := make([][]Piece, board.width)
+	for x := range pieces {
+		pieces[x] = append([]Piece{}, board.pieces[x]...)
+	}
+	pieces[move.x][move.y] = move.piece
+	captured := 0
+	for i := range cellOffsets {
+		newX, newY := move.x+cellOffsets[i][0], move.y+cellOffsets[i][1]
+		if newX < 0 || newX >= board.width || newY < 0 || newY >= board.height || pieces[newX][newY] != move.piece.Opponent() {
+			continue
+		}
+		group, liberty := board.group(pieces, newX, newY)
+		if !liberty {
+			for _, stone := range group {
+				pieces[stone.X][stone.Y] = Empty
+			}
+			captured += len(group)
+		}
+	}
+	suicided := 0
+	group, liberty := board.group(pieces, move.x, move.y)
+	if !liberty {
+		if !board.rules.Suicide || len(group) == 1 {
+			return false
+		}
+		for _, stone := range group {
+			pieces[stone.X][stone.Y] = Empty
+		}
+		suicided = len(group)
+	}
+	key := board.key(pieces)
+	next := move.piece.Opponent()
+	for i := range board.history {
+		switch board.rules.Ko {
+		case SimpleKo:
+			if i == len(board.history)-2 && board.history[i] == key {
+				return false
+			}
+		case PositionalSuperko:
+			if board.history[i] == key {
+				return false
+			}
+		case SituationalSuperko:
+			if board.history[i] == key && board.next[i] == next {
+				return false
+			}
+		}
+	}
+	board.pieces = pieces
+	board.captures.Add(move.piece, captured)
+	board.captures.Add(move.piece.Opponent(), suicided)
+	board.history = append(board.history, key)
+	board.next = append(board.next, next)
+	return true
+}
+
+// TestBoardMatchesReference plays random games on Board, BitBoard and the reference board
+// and reports the first move where they disagree, or where a rejected move changed the board
+func TestBoardMatchesReference(t *testing.T) {
+	games := 500
+	if testing.Short() {
+		games = 50
+	}
+	random := rand.New(rand.NewSource(1))
+	for game := 0; game < games; game++ {
+		width, height := minBoardSize+random.Intn(12), minBoardSize+random.Intn(12)
+		rules := Rules{"random", KoRule(random.Intn(3)), random.Intn(2) == 0, AreaScoring, FreeHandicap, 0}
+		board := MakeBoard(width, height)
+		board.SetRules(rules)
+		bitBoard := MakeBitBoard(width, height)
+		bitBoard.SetRules(rules)
+		reference := makeReferenceBoard(width, height, rules, Black)
+		turn := Black
+		for moves := 0; moves < width*height*3; moves++ {
+			move := &Move{random.Intn(width), random.Intn(height), turn}
+			if random.Intn(20) == 0 {
+				move = MakePass(turn)
+			}
+			before, hash, captures := board.Pieces(), board.hash, board.Captures()
+			legal := board.IsLegal(move)
+			err := board.Move(move)
+			failure := ""
+			switch {
+			case legal != (err == nil):
+				failure = fmt.Sprintf("IsLegal is %t but Move returned %v", legal, err)
+			case reference.Move(move) != (err == nil):
+				failure = fmt.Sprintf("reference disagrees with %v", err)
+			case (bitBoard.Move(move) == nil) != (err == nil):
+				failure = "bitboard disagrees"
+			case err != nil && (board.hash != hash || board.Captures() != captures || fmt.Sprint(board.Pieces()) != fmt.Sprint(before)):
+				failure = fmt.Sprintf("rejected move changed the board: %v", err)
+			case !reference.matches(board.Pieces()) || !reference.matches(bitBoard.Pieces()):
+				failure = "positions differ"
+			case board.Captures() != reference.captures || bitBoard.Captures() != reference.captures:
+				failure = "captures differ"
+			case board.hash != board.data.Hash():
+				failure = "hash is out of sync"
+			}
+			if failure != "" {
+				t.Fatalf("game %d, %s with %s ko and suicide %t: %s\n%s", game, move, rules.Ko, rules.Suicide, failure, board.String(true))
+			}
+			if err == nil {
+				turn = turn.Opponent()
+			}
+		}
+	}
+}
+
+// TestSituationalSuperkoStartingPosition checks the starting position is repeated with black to move
+// Both colors fill the board by suicide, which empties it again
+func TestSituationalSuperkoStartingPosition(t *testing.T) {
+	rules := Rules{"random", SituationalSuperko, true, AreaScoring, FreeHandicap, 0}
+	board := MakeBoard(2, 1)
+	board.SetRules(rules)
+	bitBoard := MakeBitBoard(2, 1)
+	bitBoard.SetRules(rules)
+	reference := makeReferenceBoard(2, 1, rules, Black)
+	moves := []*Move{{0, 0, Black}, MakePass(White), {1, 0, Black}, {0, 0, White}, MakePass(Black)}
+	for _, move := range moves {
+		if board.Move(move) != nil || bitBoard.Move(move) != nil || !reference.Move(move) {
+			t.Fatalf("%s should be legal", move)
+		}
+	}
+	repeat := &Move{1, 0, White}
+	if board.Move(repeat) == nil || bitBoard.Move(repeat) == nil || reference.Move(repeat) {
+		t.Fatalf("%s repeats the starting position with black to move", repeat)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Review goes over a finished game, moving through its tree and trying variations
+func (game *Game) Review() error {
+	if game.Phase != Finished {
+		return errors.New("Only finished games can be reviewed")
+	}
+	game.Phase = Reviewing
+	game.undoRequest = Empty
+	return nil
+}
+
+// Next plays the move of a variation after the current node, 0 is the main line
+func (game *Game) Next(variation int) (MoveResult, error) {
+	if game.Phase != Reviewing {
+		return Illegal, errors.New("Moves can only be followed when reviewing")
+	}
+	variations := game.Board.tree.Current().Variations()
+	if variation < 0 || variation >= len(variations) {
+		return Illegal, fmt.Errorf("Variation %d not found", variation)
+	}
+	return game.Move(variations[variation].move)
+}
+
+// Previous takes back the move of the current node
+func (game *Game) Previous() error {
+	if game.Phase != Reviewing {
+		return errors.New("Moves can only be followed when reviewing")
+	}
+	return game.Undo()
+}
+
+// GoTo moves through the tree to the node with id, replaying the moves on the way
+func (game *Game) GoTo(id int) error {
+	if game.Phase != Reviewing {
+		return errors.New("Moves can only be followed when reviewing")
+	}
+	tree := game.Board.tree
+	target, err := tree.Node(id)
+	if err != nil {
+		return err
+	}
+	for !tree.Current().isAncestorOf(target) {
+		err = game.Undo()
+		if err != nil {
+			return err
+		}
+	}
+	nodes := []*Node{}
+	for node := target; node != tree.Current(); node = node.parent {
+		nodes = append(nodes, node)
+	}
+	for i := len(nodes) - 1; i >= 0; i-- {
+		_, err = game.Move(nodes[i].move)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SwitchVariation goes to another variation of the move of the current node
+func (game *Game) SwitchVariation(variation int) error {
+	parent := game.Board.tree.Current().parent
+	if parent == nil {
+		return errors.New("The starting position has no other variations")
+	}
+	if variation < 0 || variation >= len(parent.children) {
+		return fmt.Errorf("Variation %d not found", variation)
+	}
+	return game.GoTo(parent.children[variation].id)
+}
+
+// Comment writes text on the current node of the tree
+func (game *Game) Comment(text string) {
+	game.Board.tree.SetComment(text)
+}
+
+// Mark draws a mark on the current node of the tree
+func (game *Game) Mark(mark Mark) error {
+	if !game.Board.Inbounds(mark.X, mark.Y) {
+		return fmt.Errorf("(%d, %d) is out of bounds", mark.X, mark.Y)
+	}
+	if mark.Shape == Label && mark.Label == "" {
+		return errors.New("Label mark should have a text")
+	}
+	game.Board.tree.SetMark(mark)
+	return nil
+}
+
+// Unmark erases the mark at (x, y) of the current node of the tree
+func (game *Game) Unmark(x int, y int) error {
+	if !game.Board.Inbounds(x, y) {
+		return fmt.Errorf("(%d, %d) is out of bounds", x, y)
+	}
+	game.Board.tree.RemoveMark(x, y)
+	return nil
+}
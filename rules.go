@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ScoringMethod decides how points are counted at the end of the game
+type ScoringMethod int
+
+const (
+	// AreaScoring counts stones plus territory
+	AreaScoring ScoringMethod = iota
+	// TerritoryScoring counts territory plus prisoners
+	TerritoryScoring
+)
+
+func (method ScoringMethod) String() string {
+	names := [...]string{
+		"area",
+		"territory",
+	}
+	if method < AreaScoring || method > TerritoryScoring {
+		return "unknown"
+	}
+	return names[method]
+}
+
+func (method ScoringMethod) MarshalJSON() ([]byte, error) {
+	return json.Marshal(method.String())
+}
+
+// HandicapPlacement decides where handicap stones go
+type HandicapPlacement int
+
+const (
+	// FixedHandicap puts the stones on the star points
+	FixedHandicap HandicapPlacement = iota
+	// FreeHandicap lets the weaker player place the stones anywhere
+	FreeHandicap
+)
+
+func (placement HandicapPlacement) String() string {
+	names := [...]string{
+		"fixed",
+		"free",
+	}
+	if placement < FixedHandicap || placement > FreeHandicap {
+		return "unknown"
+	}
+	return names[placement]
+}
+
+func (placement HandicapPlacement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(placement.String())
+}
+
+func (rule KoRule) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rule.String())
+}
+
+// Rules is the rule set a game is played by
+type Rules struct {
+	Name string `json:"name"`
+	Ko   KoRule `json:"ko"`
+	// Suicide allows a move which leaves its own group of several stones without liberty, removing the group
+	Suicide  bool              `json:"suicide"`
+	Scoring  ScoringMethod     `json:"scoring"`
+	Handicap HandicapPlacement `json:"handicap"`
+	Komi     float32           `json:"komi"`
+}
+
+// DefaultRules is the name of the rule set used when none is chosen
+const DefaultRules = "chinese"
+
+// ruleSets are the presets which can be chosen by name
+var ruleSets = map[string]Rules{
+	"japanese":     {"japanese", SimpleKo, false, TerritoryScoring, FixedHandicap, 6.5},
+	"chinese":      {"chinese", PositionalSuperko, false, AreaScoring, FreeHandicap, 7.5},
+	"aga":          {"aga", SituationalSuperko, false, AreaScoring, FixedHandicap, 7.5},
+	"new-zealand":  {"new-zealand", SituationalSuperko, true, AreaScoring, FreeHandicap, 7},
+	"tromp-taylor": {"tromp-taylor", PositionalSuperko, true, AreaScoring, FreeHandicap, 7.5},
+}
+
+// RulesByName finds a preset rule set, or the default one if name is empty
+func RulesByName(name string) (Rules, error) {
+	if name == "" {
+		name = DefaultRules
+	}
+	rules, ok := ruleSets[strings.ToLower(name)]
+	if !ok {
+		return Rules{}, fmt.Errorf("Unknown rules %s, should be one of: %s", name, strings.Join(RuleSetNames(), ", "))
+	}
+	return rules, nil
+}
+
+// RuleSetNames lists the names of the preset rule sets
+func RuleSetNames() []string {
+	names := make([]string, 0, len(ruleSets))
+	for name := range ruleSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,124 @@
+package main
+
+// Score is the number of points each color has
+type Score struct {
+	White float32 `json:"white"`
+	Black float32 `json:"black"`
+}
+
+// Add gives points to piece
+func (score *Score) Add(piece Piece, points float32) {
+	switch piece {
+	case White:
+		score.White += points
+	case Black:
+		score.Black += points
+	}
+}
+
+// Lead is how many points piece has over its opponent
+func (score Score) Lead(piece Piece) float32 {
+	if piece == White {
+		return score.White - score.Black
+	}
+	return score.Black - score.White
+}
+
+// Result decides the winner and by how many points
+func (score Score) Result(reason string) *Result {
+	margin := score.White - score.Black
+	switch {
+	case margin > 0:
+		return &Result{WhiteWins, reason, margin}
+	case margin < 0:
+		return &Result{BlackWins, reason, -margin}
+	default:
+		return &Result{Draw, reason, 0}
+	}
+}
+
+// Territory assigns each empty point to the color which surrounds it
+// Points which aren't empty, or are reachable by both colors, are Empty
+func (board *Board) Territory() [][]Piece {
+	territory := make([][]Piece, board.width)
+	for x := range territory {
+		territory[x] = make([]Piece, board.height)
+	}
+	visited := board.makeMarks()
+	for x := 0; x < board.width; x++ {
+		for y := 0; y < board.height; y++ {
+			if visited[x][y] || board.data[x][y].piece != Empty {
+				continue
+			}
+			region, owner := board.emptyRegion(visited, x, y)
+			for _, point := range region {
+				territory[point[0]][point[1]] = owner
+			}
+		}
+	}
+	return territory
+}
+
+// emptyRegion flood fills the empty points connected to (x, y)
+// The owner is the only color bordering the region, or Empty if both or none do
+func (board *Board) emptyRegion(visited [][]bool, x int, y int) ([][]int, Piece) {
+	region := [][]int{}
+	borders := map[Piece]bool{}
+	stack := [][]int{{x, y}}
+	visited[x][y] = true
+	for len(stack) > 0 {
+		point := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		region = append(region, point)
+		for i := range cellOffsets {
+			newX, newY := point[0]+cellOffsets[i][0], point[1]+cellOffsets[i][1]
+			if !board.Inbounds(newX, newY) {
+				continue
+			}
+			piece := board.data[newX][newY].piece
+			if piece != Empty {
+				borders[piece] = true
+				continue
+			}
+			if visited[newX][newY] {
+				continue
+			}
+			visited[newX][newY] = true
+			stack = append(stack, []int{newX, newY})
+		}
+	}
+	if len(borders) != 1 {
+		return region, Empty
+	}
+	for piece := range borders {
+		return region, piece
+	}
+	return region, Empty
+}
+
+// AreaScore counts stones plus surrounded territory for each color (Chinese rules)
+func (board *Board) AreaScore() Score {
+	score := Score{}
+	territory := board.Territory()
+	for x := 0; x < board.width; x++ {
+		for y := 0; y < board.height; y++ {
+			score.Add(board.data[x][y].piece, 1)
+			score.Add(territory[x][y], 1)
+		}
+	}
+	return score
+}
+
+// TerritoryScore counts surrounded territory plus prisoners for each color (Japanese rules)
+func (board *Board) TerritoryScore() Score {
+	score := Score{}
+	territory := board.Territory()
+	for x := 0; x < board.width; x++ {
+		for y := 0; y < board.height; y++ {
+			score.Add(territory[x][y], 1)
+		}
+	}
+	score.Add(White, float32(board.captures.White))
+	score.Add(Black, float32(board.captures.Black))
+	return score
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+// scoringGame sets up black and white walls on a 5x5 board, with a white stone left inside black's area, and passes to the scoring phase
+//
+//	. X . O .
+//	. X . O .
+//	O X . O .
+//	. X . O .
+//	. X . O .
+func scoringGame(t *testing.T, settings string) *Game {
+	values, err := url.ParseQuery(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	game, err := CreateGameFromSettings(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stones := []Move{{0, 2, White}}
+	for y := 0; y < 5; y++ {
+		stones = append(stones, Move{1, y, Black}, Move{3, y, White})
+	}
+	for _, stone := range stones {
+		err = game.Board.Setup(stone.x, stone.y, stone.piece)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	game.Pass()
+	game.Pass()
+	if game.Phase != Scoring {
+		t.Fatalf("scoring after two passes, got %s", game.Phase)
+	}
+	return game
+}
+
+func TestScoreDeadStones(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		// dead are the groups toggled, toggling twice brings a group back to life
+		dead []Position
+		want Score
+	}{
+		{"area", "size=5&rules=chinese&komi=7.5", nil, Score{White: 18.5, Black: 5}},
+		{"area with dead stones", "size=5&rules=chinese&komi=7.5", []Position{{0, 2}}, Score{White: 17.5, Black: 10}},
+		{"territory", "size=5&rules=japanese&komi=6.5", nil, Score{White: 11.5, Black: 0}},
+		{"territory with dead stones", "size=5&rules=japanese&komi=6.5", []Position{{0, 2}}, Score{White: 11.5, Black: 6}},
+		{"dead stones brought back to life", "size=5&rules=japanese&komi=6.5", []Position{{0, 2}, {0, 2}}, Score{White: 11.5, Black: 0}},
+		{"whole group dead", "size=5&rules=chinese&komi=0", []Position{{1, 3}}, Score{White: 25, Black: 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			game := scoringGame(t, test.settings)
+			for _, position := range test.dead {
+				err := game.ToggleDead(position.X, position.Y)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if score := game.Score(); score != test.want {
+				t.Errorf("score %+v, want %+v", score, test.want)
+			}
+			game.AcceptScore(Black)
+			game.AcceptScore(White)
+			want := test.want.Result("score")
+			if game.Phase != Finished || game.Result == nil || *game.Result != *want {
+				t.Errorf("result %v in %s, want %s", game.Result, game.Phase, want)
+			}
+		})
+	}
+}
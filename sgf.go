@@ -0,0 +1,151 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// sgfRules are the names of the rule sets in SGF files
+var sgfRules = map[string]string{
+	"japanese":     "Japanese",
+	"chinese":      "Chinese",
+	"aga":          "AGA",
+	"new-zealand":  "NZ",
+	"tromp-taylor": "Tromp-Taylor",
+}
+
+// sgfReasons are the SGF results of games which didn't end by counting
+var sgfReasons = map[string]string{
+	"resignation": "R",
+	"time":        "T",
+	"forfeit":     "F",
+}
+
+// sgfColor is the SGF property of moves and setup of piece
+func sgfColor(piece Piece) string {
+	if piece == White {
+		return "W"
+	}
+	return "B"
+}
+
+// sgfPoint writes (x, y) as two letters, a is 0
+func sgfPoint(x int, y int) string {
+	return string([]byte{byte('a' + x), byte('a' + y)})
+}
+
+// sgfText escapes the characters which end or escape an SGF value
+func sgfText(text string) string {
+	return strings.NewReplacer("\\", "\\\\", "]", "\\]").Replace(text)
+}
+
+// sgfResult writes the result in the form of "B+R", "W+3.5" or "0" for a draw
+func sgfResult(result *Result) string {
+	if result.Outcome == Draw {
+		return "0"
+	}
+	value := sgfColor(result.Outcome.Winner()) + "+"
+	if reason, ok := sgfReasons[result.Reason]; ok {
+		return value + reason
+	}
+	return value + strconv.FormatFloat(float64(result.Margin), 'f', -1, 32)
+}
+
+// SGF writes the game, with all its variations, comments and marks, in the SGF format (FF[4])
+func (game *Game) SGF() string {
+	var str strings.Builder
+	tree := game.Board.Tree()
+	str.WriteString("(;FF[4]GM[1]CA[UTF-8]AP[go-in-go]")
+	if game.Board.width == game.Board.height {
+		str.WriteString("SZ[" + strconv.Itoa(game.Board.width) + "]")
+	} else {
+		str.WriteString("SZ[" + strconv.Itoa(game.Board.width) + ":" + strconv.Itoa(game.Board.height) + "]")
+	}
+	str.WriteString("KM[" + strconv.FormatFloat(float64(game.Komi), 'f', -1, 32) + "]")
+	rules, ok := sgfRules[game.Rules.Name]
+	if !ok {
+		rules = game.Rules.Name
+	}
+	str.WriteString("RU[" + sgfText(rules) + "]")
+	if game.Clock != nil {
+		// TM is the main time in seconds, OT describes the overtime
+		control := game.Clock.Control()
+		str.WriteString("TM[" + strconv.FormatFloat(control.Main.Seconds(), 'f', -1, 64) + "]")
+		if control.System != Absolute {
+			str.WriteString("OT[" + sgfText(control.String()) + "]")
+		}
+	}
+	if game.Handicap > 0 {
+		str.WriteString("HA[" + strconv.Itoa(game.Handicap) + "]")
+	}
+	if game.Players.Black != "" {
+		str.WriteString("PB[" + sgfText(game.Players.Black) + "]")
+	}
+	if game.Players.White != "" {
+		str.WriteString("PW[" + sgfText(game.Players.White) + "]")
+	}
+	if game.Result != nil {
+		str.WriteString("RE[" + sgfResult(game.Result) + "]")
+	}
+	// White plays first after fixed handicap, or in games for old clients
+	if game.Board.boardHistory.next[0] == White {
+		str.WriteString("PL[W]")
+	}
+	for _, piece := range []Piece{Black, White} {
+		points := []string{}
+		for _, move := range tree.Root().setup {
+			if move.piece == piece {
+				points = append(points, sgfPoint(move.x, move.y))
+			}
+		}
+		if len(points) > 0 {
+			str.WriteString("A" + sgfColor(piece) + "[" + strings.Join(points, "][") + "]")
+		}
+	}
+	writeSGFNode(&str, tree.Root())
+	str.WriteString(")\n")
+	return str.String()
+}
+
+// writeSGFNode writes the comment and marks of node, and the nodes after it
+// The first variation continues the sequence, the others are written in parentheses
+func writeSGFNode(str *strings.Builder, node *Node) {
+	if node.move != nil {
+		str.WriteString(";" + sgfColor(node.move.piece) + "[")
+		if !node.move.IsPass() {
+			str.WriteString(sgfPoint(node.move.x, node.move.y))
+		}
+		str.WriteString("]")
+	}
+	if node.comment != "" {
+		str.WriteString("C[" + sgfText(node.comment) + "]")
+	}
+	properties := [...]string{"CR", "MA", "SQ", "TR", "LB"}
+	for shape := Circle; shape <= Label; shape++ {
+		values := []string{}
+		for _, mark := range node.Marks() {
+			if mark.Shape != shape {
+				continue
+			}
+			value := sgfPoint(mark.X, mark.Y)
+			if shape == Label {
+				value += ":" + sgfText(mark.Label)
+			}
+			values = append(values, value)
+		}
+		if len(values) > 0 {
+			str.WriteString(properties[shape] + "[" + strings.Join(values, "][") + "]")
+		}
+	}
+	switch len(node.children) {
+	case 0:
+	case 1:
+		writeSGFNode(str, node.children[0])
+	default:
+		for _, child := range node.children {
+			str.WriteString("\n(")
+			writeSGFNode(str, child)
+			str.WriteString(")")
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sgfNode is a node of an SGF file, with its properties and the nodes after it
+type sgfNode struct {
+	properties map[string][]string
+	children   []*sgfNode
+}
+
+// Limits of the SGF files which are imported, so uploads can't use up the memory or the stack
+const (
+	maxSGFSize      = 1 << 20
+	maxSGFNodes     = 10000
+	maxSGFVariation = 100
+)
+
+// sgfParser reads an SGF file one character at a time
+type sgfParser struct {
+	data     string
+	position int
+	// nodes counts the nodes read so far
+	nodes int
+}
+
+// parseSGF reads the first game of an SGF file into its tree of nodes
+func parseSGF(data string) (*sgfNode, error) {
+	if len(data) > maxSGFSize {
+		return nil, fmt.Errorf("Invalid SGF: should be up to %d bytes", maxSGFSize)
+	}
+	parser := &sgfParser{data, 0, 0}
+	parser.skipSpace()
+	if !parser.consume('(') {
+		return nil, errors.New("Invalid SGF: should start with (")
+	}
+	return parser.parseTree(0)
+}
+
+func (parser *sgfParser) skipSpace() {
+	for parser.position < len(parser.data) && strings.ContainsRune(" \t\r\n", rune(parser.data[parser.position])) {
+		parser.position++
+	}
+}
+
+// consume skips the next character if it's expected
+func (parser *sgfParser) consume(expected byte) bool {
+	parser.skipSpace()
+	if parser.position < len(parser.data) && parser.data[parser.position] == expected {
+		parser.position++
+		return true
+	}
+	return false
+}
+
+// parseTree reads a sequence of nodes and the variations after it, after the opening parenthesis
+// depth is the number of variations the sequence is nested in
+func (parser *sgfParser) parseTree(depth int) (*sgfNode, error) {
+	if depth > maxSGFVariation {
+		return nil, fmt.Errorf("Invalid SGF: variations should be nested up to %d times", maxSGFVariation)
+	}
+	var first *sgfNode
+	var last *sgfNode
+	for parser.consume(';') {
+		parser.nodes++
+		if parser.nodes > maxSGFNodes {
+			return nil, fmt.Errorf("Invalid SGF: should have up to %d nodes", maxSGFNodes)
+		}
+		node, err := parser.parseNode()
+		if err != nil {
+			return nil, err
+		}
+		if first == nil {
+			first = node
+		} else {
+			last.children = append(last.children, node)
+		}
+		last = node
+	}
+	if first == nil {
+		return nil, fmt.Errorf("Invalid SGF: expected a node at %d", parser.position)
+	}
+	for parser.consume('(') {
+		variation, err := parser.parseTree(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		last.children = append(last.children, variation)
+	}
+	if !parser.consume(')') {
+		return nil, fmt.Errorf("Invalid SGF: expected ) at %d", parser.position)
+	}
+	return first, nil
+}
+
+// parseNode reads the properties of a node, after its semicolon
+func (parser *sgfParser) parseNode() (*sgfNode, error) {
+	node := &sgfNode{map[string][]string{}, []*sgfNode{}}
+	for {
+		parser.skipSpace()
+		start := parser.position
+		for parser.position < len(parser.data) && parser.data[parser.position] >= 'A' && parser.data[parser.position] <= 'Z' {
+			parser.position++
+		}
+		if start == parser.position {
+			return node, nil
+		}
+		name := parser.data[start:parser.position]
+		values := []string{}
+		for parser.consume('[') {
+			value, err := parser.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("Invalid SGF: property %s has no value", name)
+		}
+		node.properties[name] = append(node.properties[name], values...)
+	}
+}
+
+// parseValue reads a value up to its closing bracket, after the opening one
+func (parser *sgfParser) parseValue() (string, error) {
+	var value strings.Builder
+	for parser.position < len(parser.data) {
+		char := parser.data[parser.position]
+		parser.position++
+		switch char {
+		case ']':
+			return value.String(), nil
+		case '\\':
+			if parser.position < len(parser.data) {
+				// An escaped line break is a soft one, and is removed
+				if parser.data[parser.position] != '\n' {
+					value.WriteByte(parser.data[parser.position])
+				}
+				parser.position++
+			}
+		default:
+			value.WriteByte(char)
+		}
+	}
+	return "", errors.New("Invalid SGF: value isn't closed")
+}
+
+// get is the first value of a property, or "" if the node doesn't have it
+func (node *sgfNode) get(name string) string {
+	values := node.properties[name]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// parseSGFPoint reads a point in the form of two letters, an empty point or "tt" on small boards is a pass
+func parseSGFPoint(value string, width int, height int) (int, int, error) {
+	if value == "" || value == "tt" && width <= 19 && height <= 19 {
+		return passCoordinate, passCoordinate, nil
+	}
+	if len(value) != 2 || value[0] < 'a' || value[0] > 'z' || value[1] < 'a' || value[1] > 'z' {
+		return 0, 0, fmt.Errorf("Invalid SGF point %s", value)
+	}
+	return int(value[0] - 'a'), int(value[1] - 'a'), nil
+}
+
+// parseSGFPoints reads a list of points, including rectangles in the form of "aa:cc"
+func parseSGFPoints(values []string, width int, height int) ([]Position, error) {
+	points := []Position{}
+	for _, value := range values {
+		corners := strings.Split(value, ":")
+		fromX, fromY, err := parseSGFPoint(corners[0], width, height)
+		if err != nil {
+			return nil, err
+		}
+		toX, toY := fromX, fromY
+		if len(corners) == 2 {
+			toX, toY, err = parseSGFPoint(corners[1], width, height)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for x := fromX; x <= toX; x++ {
+			for y := fromY; y <= toY; y++ {
+				points = append(points, Position{x, y})
+			}
+		}
+	}
+	return points, nil
+}
+
+// parseSGFResult reads a result in the form of "B+R", "W+3.5" or "0"
+// Other results, like "Void" for games without a result or "?" when it's unknown, are nil
+func parseSGFResult(value string) *Result {
+	if value == "0" || strings.EqualFold(value, "draw") {
+		return &Result{Draw, "score", 0}
+	}
+	parts := strings.SplitN(value, "+", 2)
+	if len(parts) != 2 {
+		return nil
+	}
+	var outcome GameResult
+	switch strings.ToUpper(parts[0]) {
+	case "B":
+		outcome = BlackWins
+	case "W":
+		outcome = WhiteWins
+	default:
+		return nil
+	}
+	// FF[4] lets the reason be written in full, like "B+Resign", so its first letter is enough
+	for reason, short := range sgfReasons {
+		if parts[1] != "" && strings.EqualFold(parts[1][:1], short) {
+			return &Result{outcome, reason, 0}
+		}
+	}
+	margin, err := strconv.ParseFloat(parts[1], 32)
+	if err != nil {
+		// Scored without saying by how much
+		return &Result{outcome, "score", 0}
+	}
+	return &Result{outcome, "score", float32(margin)}
+}
+
+// ImportSGF creates a game from the first game of an SGF file
+// The moves are replayed so they're checked to be legal, and the game can go on from the last move of the main line
+func ImportSGF(data string) (*Game, error) {
+	root, err := parseSGF(data)
+	if err != nil {
+		return nil, err
+	}
+	if gm := root.get("GM"); gm != "" && gm != "1" {
+		return nil, errors.New("Only SGF files of go games are supported")
+	}
+	width, height := 19, 19
+	if size := root.get("SZ"); size != "" {
+		width, height, err = ParseBoardSize(strings.Replace(size, ":", "x", 1))
+		if err != nil {
+			return nil, err
+		}
+	}
+	rules, err := RulesByName("")
+	if err != nil {
+		return nil, err
+	}
+	if name := root.get("RU"); name != "" {
+		for rulesName, sgfName := range sgfRules {
+			if strings.EqualFold(name, sgfName) || strings.EqualFold(name, rulesName) {
+				rules = ruleSets[rulesName]
+			}
+		}
+	}
+	game := CreateGame(width, height, rules)
+	game.Players = Players{root.get("PB"), root.get("PW")}
+	if komi := root.get("KM"); komi != "" {
+		value, err := strconv.ParseFloat(komi, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid SGF komi %s", komi)
+		}
+		game.Komi = float32(value)
+	}
+	// PL only says who moves next, black still moved first and komi goes to white
+	if root.get("PL") == "W" {
+		if handicap := root.get("HA"); handicap == "" || handicap == "0" {
+			// White moved first, like in games for old clients
+			err = game.SetFirstPlayer(White)
+		} else {
+			// White moves after the handicap stones of black
+			game.Turn = White
+			err = game.Board.SetStartingTurn(White)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, piece := range []Piece{Black, White} {
+		points, err := parseSGFPoints(root.properties["A"+sgfColor(piece)], width, height)
+		if err != nil {
+			return nil, err
+		}
+		for _, point := range points {
+			err = game.Board.Setup(point.X, point.Y, piece)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if handicap := root.get("HA"); handicap != "" {
+		stones, err := strconv.Atoi(handicap)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid SGF handicap %s", handicap)
+		}
+		game.Handicap = stones
+		if stones > 0 && len(root.properties["AB"]) == 0 {
+			// Handicap stones without setup are placed freely as the first moves
+			game.handicapLeft = stones
+		} else if stones > 0 && root.get("PL") == "" {
+			game.Turn = game.first.Opponent()
+			err = game.Board.SetStartingTurn(game.Turn)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	err = importSGFNode(game, root)
+	if err != nil {
+		return nil, err
+	}
+	// Go on from the end of the main line
+	for _, move := range game.Board.Tree().MainLine() {
+		_, err = game.Move(move)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Games without a known result can go on
+	if result := parseSGFResult(root.get("RE")); result != nil {
+		game.Result = result
+		game.Phase = Finished
+	}
+	return game, nil
+}
+
+// importSGFNode adds the comment and marks of node, then plays every variation after it and comes back
+func importSGFNode(game *Game, node *sgfNode) error {
+	width, height := game.Board.Size()
+	tree := game.Board.Tree()
+	if comment := node.get("C"); comment != "" {
+		tree.SetComment(comment)
+	}
+	properties := [...]string{"CR", "MA", "SQ", "TR"}
+	for shape := Circle; shape < Label; shape++ {
+		points, err := parseSGFPoints(node.properties[properties[shape]], width, height)
+		if err != nil {
+			return err
+		}
+		for _, point := range points {
+			err = game.Mark(Mark{point.X, point.Y, shape, ""})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, label := range node.properties["LB"] {
+		parts := strings.SplitN(label, ":", 2)
+		x, y, err := parseSGFPoint(parts[0], width, height)
+		if err != nil || len(parts) != 2 || x == passCoordinate {
+			return fmt.Errorf("Invalid SGF label %s", label)
+		}
+		err = game.Mark(Mark{x, y, Label, parts[1]})
+		if err != nil {
+			return err
+		}
+	}
+	// Every move played goes in front of the variations, so they're played from the last one to keep their order
+	for i := len(node.children) - 1; i >= 0; i-- {
+		child := node.children[i]
+		if _, ok := child.properties["AB"]; ok {
+			return errors.New("Only SGF files with setup on the first node are supported")
+		}
+		if _, ok := child.properties["AW"]; ok {
+			return errors.New("Only SGF files with setup on the first node are supported")
+		}
+		var move *Move
+		for _, piece := range []Piece{Black, White} {
+			value, ok := child.properties[sgfColor(piece)]
+			if !ok {
+				continue
+			}
+			x, y, err := parseSGFPoint(value[0], width, height)
+			if err != nil {
+				return err
+			}
+			move = &Move{x, y, piece}
+		}
+		if move != nil {
+			_, err := game.Move(move)
+			if err != nil {
+				return fmt.Errorf("Invalid move %d, %s: %s", game.Board.moves+1, move, err)
+			}
+		}
+		err := importSGFNode(game, child)
+		if err != nil {
+			return err
+		}
+		if move != nil {
+			err = game.Undo()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
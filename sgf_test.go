@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// playSteps plays "x y" or "pass" for the player to move, "undo" takes back the last move and "resign" resigns
+func playSteps(t *testing.T, game *Game, steps []string) {
+	for _, step := range steps {
+		var err error
+		switch step {
+		case "undo":
+			err = game.Undo()
+		case "resign":
+			err = game.Resign(game.Turn)
+		default:
+			var move *Move
+			move, err = ParseMove(step, game.Turn)
+			if err == nil {
+				_, err = game.Move(move)
+			}
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", step, err)
+		}
+	}
+}
+
+func TestSGFRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		steps    []string
+		// contains is a part of the SGF the game should be written with
+		contains string
+	}{
+		{"moves", "size=9", []string{"2 2", "6 6", "3 3"}, ";B[cc];W[gg];B[dd]"},
+		{"undo", "size=9", []string{"2 2", "6 6", "undo", "5 5", "3 3"}, ";B[cc]\n(;W[ff];B[dd])\n(;W[gg])"},
+		{"komi", "size=9&komi=0", []string{"4 4"}, "KM[0]"},
+		{"fixed handicap", "size=9&rules=japanese&handicap=3", []string{"4 4"}, "HA[3]"},
+		{"free handicap", "size=9&rules=chinese&handicap=2", []string{"2 2", "6 6", "4 4"}, "HA[2]"},
+		{"free handicap ended by a pass", "size=2&rules=chinese&handicap=4", []string{"0 0", "1 0", "0 1", "pass"}, ";B[ab];B[]"},
+		{"white first", "size=9&first=white", []string{"4 4", "2 2"}, "PL[W]"},
+		{"resigned", "size=9", []string{"4 4", "resign"}, "RE[B+R]"},
+		{"scored", "size=5", []string{"pass", "pass"}, "RE[W+7.5]"},
+		{"rectangular", "size=7x5", []string{"6 4", "0 0"}, "SZ[7:5]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settings, err := url.ParseQuery(test.settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			game, err := CreateGameFromSettings(settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			playSteps(t, game, test.steps)
+			if game.Phase == Scoring {
+				game.AcceptScore(Black)
+				game.AcceptScore(White)
+			}
+			sgf := game.SGF()
+			if !strings.Contains(sgf, test.contains) {
+				t.Fatalf("%q not written in %s", test.contains, sgf)
+			}
+			imported, err := ImportSGF(sgf)
+			if err != nil {
+				t.Fatalf("%s in %s", err, sgf)
+			}
+			if imported.SGF() != sgf {
+				t.Errorf("SGF changed from %s to %s", sgf, imported.SGF())
+			}
+			if imported.Komi != game.Komi || imported.Handicap != game.Handicap || imported.Rules.Name != game.Rules.Name {
+				t.Errorf("komi %v, handicap %d, rules %s imported as %v, %d, %s", game.Komi, game.Handicap, game.Rules.Name, imported.Komi, imported.Handicap, imported.Rules.Name)
+			}
+			if imported.Turn != game.Turn || imported.FirstPlayer() != game.FirstPlayer() || imported.Phase != game.Phase {
+				t.Errorf("%s to move first, %s next in %s imported as %s, %s in %s", game.FirstPlayer(), game.Turn, game.Phase, imported.FirstPlayer(), imported.Turn, imported.Phase)
+			}
+			if imported.Board.String(false) != game.Board.String(false) {
+				t.Errorf("board %s imported as %s", game.Board.String(false), imported.Board.String(false))
+			}
+			if game.Result != nil && (imported.Result == nil || imported.Result.String() != game.Result.String()) {
+				t.Errorf("result %s imported as %v", game.Result, imported.Result)
+			}
+		})
+	}
+}
@@ -4,10 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"net/http"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	log "github.com/cloudflare/cfssl/log"
@@ -17,28 +20,43 @@ import (
 type SocketIOServer struct {
 	port         int
 	gameSessions map[string]*IOGameSession
+	// lock is held while gameSessions is read or changed
+	lock sync.Mutex
 }
 
-type Player struct {
+// IOPlayer is a player connected to a game over socket.io
+type IOPlayer struct {
 	id     string
 	piece  Piece
 	socket socketio.Socket
 }
 
 type IOGameSession struct {
+	// lock is held while the game or the players of the session are read or changed
+	lock    sync.Mutex
 	game    *Game
-	player1 *Player
-	player2 *Player
+	player1 *IOPlayer
+	player2 *IOPlayer
+	// bot plays second when the game is against the computer
+	bot Player
+	// thinking is held while the bot plays, so it answers one action at a time
+	thinking sync.Mutex
+	// timer ends the game when the player to move runs out of time
+	timer *time.Timer
 }
 
-func (gameSession *IOGameSession) join(so *socketio.Socket) (*Player, error) {
-	var player *Player
+func (gameSession *IOGameSession) join(so *socketio.Socket) (*IOPlayer, error) {
+	var player *IOPlayer
 	playerid := "player-" + strconv.Itoa(rand.New(rand.NewSource(time.Now().UnixNano())).Int())
+	// The bot plays the second color of games against the computer
+	if gameSession.bot != nil && gameSession.player1 != nil {
+		return nil, errors.New("can't join room: the other player is a bot")
+	}
 	if gameSession.player1 == nil {
-		player = &Player{playerid, White, *so}
+		player = &IOPlayer{playerid, gameSession.game.FirstPlayer(), *so}
 		gameSession.player1 = player
 	} else if gameSession.player2 == nil {
-		player = &Player{playerid, Black, *so}
+		player = &IOPlayer{playerid, gameSession.game.FirstPlayer().Opponent(), *so}
 		gameSession.player2 = player
 	} else {
 		return nil, errors.New("can't join room")
@@ -48,7 +66,7 @@ func (gameSession *IOGameSession) join(so *socketio.Socket) (*Player, error) {
 
 func (gameSession *IOGameSession) ready() bool {
 	return gameSession.player1 != nil &&
-		gameSession.player2 != nil
+		(gameSession.player2 != nil || gameSession.bot != nil)
 }
 
 func (gameSession *IOGameSession) abandoned() bool {
@@ -56,9 +74,97 @@ func (gameSession *IOGameSession) abandoned() bool {
 		gameSession.player2 == nil
 }
 
+// opponent is the other player of the session
+func (gameSession *IOGameSession) opponent(player *IOPlayer) *IOPlayer {
+	if player == gameSession.player1 {
+		return gameSession.player2
+	}
+	return gameSession.player1
+}
+
+// emit sends the event with its data, usually the game ID, to the players connected to the game
+func (gameSession *IOGameSession) emit(event string, data string) {
+	for _, player := range []*IOPlayer{gameSession.player1, gameSession.player2} {
+		if player != nil {
+			player.socket.Emit(event, data)
+		}
+	}
+}
+
+// boardChanged tells the players to fetch the game, and sends them the clock of timed games
 func (gameSession *IOGameSession) boardChanged(gameID string) {
-	gameSession.player1.socket.Emit("board_changed", gameID)
-	gameSession.player2.socket.Emit("board_changed", gameID)
+	gameSession.emit("board_changed", gameID)
+	if gameSession.game.Clock != nil {
+		clock, err := json.Marshal(gameSession.game.Clock)
+		if err == nil {
+			gameSession.emit("clock", string(clock))
+		}
+	}
+	gameSession.watchClock(gameID)
+}
+
+// watchClock ends the game when the player to move runs out of time, even if nobody does anything
+// It's called with the lock of the session held, and the timer takes the lock when it fires
+func (gameSession *IOGameSession) watchClock(gameID string) {
+	game := gameSession.game
+	if gameSession.timer != nil {
+		gameSession.timer.Stop()
+	}
+	if game.Clock == nil || game.Clock.Running() == Empty {
+		return
+	}
+	gameSession.timer = time.AfterFunc(game.Clock.TimeLeft(game.Clock.Running()), func() {
+		gameSession.lock.Lock()
+		defer gameSession.lock.Unlock()
+		if !game.CheckTime() {
+			gameSession.watchClock(gameID)
+			return
+		}
+		log.Debugf("[%s] %s\n", gameID, game.Result)
+		gameSession.boardChanged(gameID)
+		gameSession.gameOver(gameID)
+	})
+}
+
+func (gameSession *IOGameSession) scoringStarted(gameID string) {
+	gameSession.emit("scoring_started", gameID)
+}
+
+func (gameSession *IOGameSession) gameOver(gameID string) {
+	gameSession.emit("game_over", gameID)
+}
+
+// botReply lets the bot answer the last action of the player, if the game is against the computer
+// The bot can think for a while, so the player is told about its moves later with board_changed
+func (gameSession *IOGameSession) botReply(gameID string) {
+	if gameSession.bot == nil {
+		return
+	}
+	go gameSession.botTurn(gameID)
+}
+
+func (gameSession *IOGameSession) botTurn(gameID string) {
+	gameSession.thinking.Lock()
+	defer gameSession.thinking.Unlock()
+	gameSession.lock.Lock()
+	defer gameSession.lock.Unlock()
+	game := gameSession.game
+	version, phase := game.Board.version, game.Phase
+	err := botTurn(game, gameSession.bot, game.FirstPlayer().Opponent(), &gameSession.lock)
+	if err != nil {
+		log.Errorf("[%s] Bot failed to play: %s\n", gameID, err)
+	}
+	if version == game.Board.version && phase == game.Phase {
+		return
+	}
+	log.Debugf("[%s] Bot played\n", gameID)
+	gameSession.boardChanged(gameID)
+	switch {
+	case phase != game.Phase && game.Phase == Scoring:
+		gameSession.scoringStarted(gameID)
+	case phase != game.Phase && game.IsOver():
+		gameSession.gameOver(gameID)
+	}
 }
 
 func MakeSocketIOServer(port int) *SocketIOServer {
@@ -66,6 +172,7 @@ func MakeSocketIOServer(port int) *SocketIOServer {
 	return &SocketIOServer{
 		port,
 		gameSessions,
+		sync.Mutex{},
 	}
 }
 
@@ -97,12 +204,14 @@ func (server *SocketIOServer) handleGame() http.HandlerFunc {
 			}
 			gameID := matches[1]
 			if gameID == "" {
+				server.lock.Lock()
 				keys := make([]string, len(server.gameSessions))
 				i := 0
 				for k := range server.gameSessions {
 					keys[i] = k
 					i++
 				}
+				server.lock.Unlock()
 				bytes, err := json.Marshal(keys)
 				if err != nil {
 					w.WriteHeader(http.StatusInternalServerError)
@@ -110,12 +219,23 @@ func (server *SocketIOServer) handleGame() http.HandlerFunc {
 				}
 				w.Write(bytes)
 			} else {
-				session, ok := server.gameSessions[gameID]
+				// The game is downloaded as SGF from /game/<id>.sgf
+				sgf := strings.HasSuffix(gameID, ".sgf")
+				server.lock.Lock()
+				session, ok := server.gameSessions[strings.TrimSuffix(gameID, ".sgf")]
+				server.lock.Unlock()
 				if !ok {
 					w.WriteHeader(http.StatusNotFound)
 					return
 				}
+				session.lock.Lock()
+				defer session.lock.Unlock()
 				game := session.game
+				if sgf {
+					w.Header().Set("Content-Type", "application/x-go-sgf")
+					w.Write([]byte(game.SGF()))
+					return
+				}
 				bytes, err := json.Marshal(game)
 				if err != nil {
 					w.WriteHeader(http.StatusInternalServerError)
@@ -124,15 +244,45 @@ func (server *SocketIOServer) handleGame() http.HandlerFunc {
 				w.Write(bytes)
 			}
 		case http.MethodPut:
+			// The game is created from the settings, or imported from an SGF file sent as the body
+			body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxSGFSize))
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			var game *Game
+			if len(strings.TrimSpace(string(body))) > 0 {
+				game, err = ImportSGF(string(body))
+			} else {
+				game, err = CreateGameFromSettings(r.URL.Query())
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(err.Error()))
+				return
+			}
 			r1 := rand.New(rand.NewSource(time.Now().UnixNano()))
 			gameID := strconv.Itoa(r1.Int())
+			// "bot" chooses a built-in bot as the second player
+			var bot Player
+			if r.URL.Query().Get("bot") != "" {
+				bot, err = MakeBot(r.URL.Query().Get("bot"))
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					w.Write([]byte(err.Error()))
+					return
+				}
+			}
+			server.lock.Lock()
 			server.gameSessions[gameID] = &IOGameSession{
-				CreateGame(9, 4.5), nil, nil,
+				sync.Mutex{}, game, nil, nil, bot, sync.Mutex{}, nil,
 			}
+			server.lock.Unlock()
 			type GameCreated struct {
 				GameID string `json:"gameId"`
+				Rules  Rules  `json:"rules"`
 			}
-			bytes, _ := json.Marshal(&GameCreated{gameID})
+			bytes, _ := json.Marshal(&GameCreated{gameID, game.PlayedRules()})
 			w.Write(bytes)
 		default:
 			w.WriteHeader(http.StatusMethodNotAllowed)
@@ -142,19 +292,23 @@ func (server *SocketIOServer) handleGame() http.HandlerFunc {
 
 func (server *SocketIOServer) handleConnection(so socketio.Socket) {
 	// Handle user connecting to server by either joining a game
-	var player *Player
+	var player *IOPlayer
 	gameIDParams, ok := so.Request().URL.Query()["gameID"]
 	if !ok || len(gameIDParams) != 1 {
 		so.Emit("error", "Invalid request. Must provide gameID parameter")
 	}
 	gameID := gameIDParams[0]
+	server.lock.Lock()
 	gameSession, found := server.gameSessions[gameID]
+	server.lock.Unlock()
 	if !found {
 		log.Debugf("User attempted to join an invalid game: %s\n", gameID)
 		so.Emit("error", "Cannot find game")
 		return
 	}
+	gameSession.lock.Lock()
 	player, err := gameSession.join(&so)
+	gameSession.lock.Unlock()
 	if err != nil {
 		log.Debugf("User attempted to join an already full game: %s\n", gameID, err)
 		so.Emit("error", "Room already full")
@@ -165,22 +319,51 @@ func (server *SocketIOServer) handleConnection(so socketio.Socket) {
 
 	// Waiting for second player to join so we'll be ready
 	// Maybe better approach is the server will notify itself on game_started?
-	for !gameSession.ready() {
+	for {
 		// TODO timeout
+		gameSession.lock.Lock()
+		ready := gameSession.ready()
+		gameSession.lock.Unlock()
+		if ready {
+			break
+		}
 	}
 
 	// Game is ready, handle movement logic
+	gameSession.lock.Lock()
 	so.Emit("game_started", gameSession.game.Board.Pieces())
+	gameSession.game.StartClock()
+	gameSession.watchClock(gameID)
+	gameSession.botReply(gameID)
+	gameSession.lock.Unlock()
 	so.On("move", server.handleMove(gameID, gameSession, player))
+	so.On("pass", server.handlePass(gameID, gameSession, player))
+	so.On("resign", server.handleResign(gameID, gameSession, player))
+	so.On("toggle_dead", server.handleToggleDead(gameID, gameSession, player))
+	so.On("chain", server.handleChain(gameID, gameSession, player))
+	so.On("accept_score", server.handleAcceptScore(gameID, gameSession, player))
+	so.On("resume_play", server.handleResumePlay(gameID, gameSession, player))
+	so.On("undo_request", server.handleUndoRequest(gameID, gameSession, player))
+	so.On("undo_accept", server.handleUndoAccept(gameID, gameSession, player))
+	so.On("undo_decline", server.handleUndoDecline(gameID, gameSession, player))
+	so.On("review", server.handleReview(gameID, gameSession, player))
+	so.On("next", server.handleNext(gameID, gameSession, player))
+	so.On("previous", server.handlePrevious(gameID, gameSession, player))
+	so.On("switch_variation", server.handleSwitchVariation(gameID, gameSession, player))
+	so.On("goto_node", server.handleGoToNode(gameID, gameSession, player))
+	so.On("comment", server.handleComment(gameID, gameSession, player))
+	so.On("mark", server.handleMark(gameID, gameSession, player))
 	so.On("disconnection", func(so *socketio.Socket) {
+		gameSession.lock.Lock()
+		defer gameSession.lock.Unlock()
 		log.Debugf("[%s] Player(%s) %s disconnected\n", gameID, player.piece, player.id)
-		switch player.piece {
-		case White:
+		switch player {
+		case gameSession.player1:
 			gameSession.player1 = nil
 			if !gameSession.abandoned() {
 				gameSession.player2.socket.Emit("message", "Other player left")
 			}
-		case Black:
+		case gameSession.player2:
 			gameSession.player2 = nil
 			if !gameSession.abandoned() {
 				gameSession.player1.socket.Emit("message", "Other player left")
@@ -188,14 +371,18 @@ func (server *SocketIOServer) handleConnection(so socketio.Socket) {
 		}
 		if gameSession.abandoned() {
 			log.Debugf("[%s] Both players left. Closing the game\n", gameID)
+			server.lock.Lock()
 			delete(server.gameSessions, gameID)
+			server.lock.Unlock()
 		}
 	})
 }
 
-func (server *SocketIOServer) handleMove(gameID string, gameSession *IOGameSession, player *Player) interface{} {
+func (server *SocketIOServer) handleMove(gameID string, gameSession *IOGameSession, player *IOPlayer) interface{} {
 	game := gameSession.game
 	return func(data string) {
+		gameSession.lock.Lock()
+		defer gameSession.lock.Unlock()
 		var position Position
 		err := json.Unmarshal([]byte(data), &position)
 		if err != nil {
@@ -204,12 +391,291 @@ func (server *SocketIOServer) handleMove(gameID string, gameSession *IOGameSessi
 		}
 
 		result, err := game.Move(&Move{position.X, position.Y, player.piece})
-		if result == Ok {
-			gameSession.boardChanged(gameID)
-			log.Debugf(game.Board.String(false))
-			log.Debugf("[%s] Player %s moved %s\n", gameID, player.piece)
-		} else {
+		server.moved(gameID, gameSession, player, result, err)
+	}
+}
+
+func (server *SocketIOServer) handlePass(gameID string, gameSession *IOGameSession, player *IOPlayer) interface{} {
+	game := gameSession.game
+	return func() {
+		gameSession.lock.Lock()
+		defer gameSession.lock.Unlock()
+		result, err := game.Move(MakePass(player.piece))
+		server.moved(gameID, gameSession, player, result, err)
+	}
+}
+
+func (server *SocketIOServer) handleResign(gameID string, gameSession *IOGameSession, player *IOPlayer) interface{} {
+	game := gameSession.game
+	return func() {
+		gameSession.lock.Lock()
+		defer gameSession.lock.Unlock()
+		err := game.Resign(player.piece)
+		if err != nil {
+			player.socket.Emit("error", err.Error())
+			return
+		}
+		log.Debugf("[%s] Player(%s) %s resigned\n", gameID, player.piece, player.id)
+		gameSession.gameOver(gameID)
+	}
+}
+
+func (server *SocketIOServer) handleToggleDead(gameID string, gameSession *IOGameSession, player *IOPlayer) interface{} {
+	game := gameSession.game
+	return func(data string) {
+		gameSession.lock.Lock()
+		defer gameSession.lock.Unlock()
+		var position Position
+		err := json.Unmarshal([]byte(data), &position)
+		if err != nil {
+			player.socket.Emit("error", "Invalid syntax!")
+			return
+		}
+		err = game.ToggleDead(position.X, position.Y)
+		if err != nil {
+			player.socket.Emit("error", err.Error())
+			return
+		}
+		log.Debugf("[%s] Player %s toggled dead pieces at (%d, %d)\n", gameID, player.piece, position.X, position.Y)
+		gameSession.boardChanged(gameID)
+		gameSession.botReply(gameID)
+	}
+}
+
+// handleChain answers the player with the chain at a position and its liberties
+func (server *SocketIOServer) handleChain(gameID string, gameSession *IOGameSession, player *IOPlayer) interface{} {
+	game := gameSession.game
+	return func(data string) {
+		gameSession.lock.Lock()
+		defer gameSession.lock.Unlock()
+		var position Position
+		err := json.Unmarshal([]byte(data), &position)
+		if err != nil {
+			player.socket.Emit("error", "Invalid syntax!")
+			return
+		}
+		chain, err := game.Board.Chain(position.X, position.Y)
+		if err != nil {
+			player.socket.Emit("error", err.Error())
+			return
+		}
+		bytes, err := json.Marshal(chain)
+		if err != nil {
+			player.socket.Emit("error", err.Error())
+			return
+		}
+		player.socket.Emit("chain", string(bytes))
+	}
+}
+
+func (server *SocketIOServer) handleAcceptScore(gameID string, gameSession *IOGameSession, player *IOPlayer) interface{} {
+	game := gameSession.game
+	return func() {
+		gameSession.lock.Lock()
+		defer gameSession.lock.Unlock()
+		result, err := game.AcceptScore(player.piece)
+		if err != nil {
 			player.socket.Emit("error", err.Error())
+			return
+		}
+		log.Debugf("[%s] Player %s accepted the score\n", gameID, player.piece)
+		if result == GameOver {
+			log.Debugf("[%s] Game over: %s\n", gameID, game.Result)
+			gameSession.gameOver(gameID)
+		}
+		gameSession.botReply(gameID)
+	}
+}
+
+func (server *SocketIOServer) handleResumePlay(gameID string, gameSession *IOGameSession, player *IOPlayer) interface{} {
+	game := gameSession.game
+	return func() {
+		gameSession.lock.Lock()
+		defer gameSession.lock.Unlock()
+		err := game.ResumePlay()
+		if err != nil {
+			player.socket.Emit("error", err.Error())
+			return
+		}
+		log.Debugf("[%s] Player %s resumed play\n", gameID, player.piece)
+		gameSession.boardChanged(gameID)
+		gameSession.botReply(gameID)
+	}
+}
+
+func (server *SocketIOServer) handleUndoRequest(gameID string, gameSession *IOGameSession, player *IOPlayer) interface{} {
+	game := gameSession.game
+	return func() {
+		gameSession.lock.Lock()
+		defer gameSession.lock.Unlock()
+		err := game.RequestUndo(player.piece)
+		if err != nil {
+			player.socket.Emit("error", err.Error())
+			return
+		}
+		log.Debugf("[%s] Player %s asked to undo\n", gameID, player.piece)
+		if opponent := gameSession.opponent(player); opponent != nil {
+			opponent.socket.Emit("undo_requested", gameID)
 		}
+		gameSession.botReply(gameID)
+	}
+}
+
+func (server *SocketIOServer) handleUndoAccept(gameID string, gameSession *IOGameSession, player *IOPlayer) interface{} {
+	game := gameSession.game
+	return func() {
+		gameSession.lock.Lock()
+		defer gameSession.lock.Unlock()
+		err := game.AcceptUndo(player.piece)
+		if err != nil {
+			player.socket.Emit("error", err.Error())
+			return
+		}
+		log.Debugf("[%s] Player %s accepted the undo\n", gameID, player.piece)
+		gameSession.boardChanged(gameID)
+	}
+}
+
+func (server *SocketIOServer) handleUndoDecline(gameID string, gameSession *IOGameSession, player *IOPlayer) interface{} {
+	game := gameSession.game
+	return func() {
+		gameSession.lock.Lock()
+		defer gameSession.lock.Unlock()
+		err := game.DeclineUndo(player.piece)
+		if err != nil {
+			player.socket.Emit("error", err.Error())
+			return
+		}
+		log.Debugf("[%s] Player %s declined the undo\n", gameID, player.piece)
+		if opponent := gameSession.opponent(player); opponent != nil {
+			opponent.socket.Emit("undo_declined", gameID)
+		}
+	}
+}
+
+func (server *SocketIOServer) handleReview(gameID string, gameSession *IOGameSession, player *IOPlayer) interface{} {
+	game := gameSession.game
+	return func() {
+		gameSession.lock.Lock()
+		defer gameSession.lock.Unlock()
+		err := game.Review()
+		if err != nil {
+			player.socket.Emit("error", err.Error())
+			return
+		}
+		log.Debugf("[%s] Player %s started reviewing\n", gameID, player.piece)
+		gameSession.boardChanged(gameID)
+	}
+}
+
+func (server *SocketIOServer) handleNext(gameID string, gameSession *IOGameSession, player *IOPlayer) interface{} {
+	game := gameSession.game
+	return func(data string) {
+		gameSession.lock.Lock()
+		defer gameSession.lock.Unlock()
+		variation, err := strconv.Atoi(data)
+		if err != nil {
+			player.socket.Emit("error", "Invalid syntax!")
+			return
+		}
+		_, err = game.Next(variation)
+		server.reviewed(gameID, gameSession, player, err)
+	}
+}
+
+func (server *SocketIOServer) handlePrevious(gameID string, gameSession *IOGameSession, player *IOPlayer) interface{} {
+	game := gameSession.game
+	return func() {
+		gameSession.lock.Lock()
+		defer gameSession.lock.Unlock()
+		err := game.Previous()
+		server.reviewed(gameID, gameSession, player, err)
+	}
+}
+
+func (server *SocketIOServer) handleSwitchVariation(gameID string, gameSession *IOGameSession, player *IOPlayer) interface{} {
+	game := gameSession.game
+	return func(data string) {
+		gameSession.lock.Lock()
+		defer gameSession.lock.Unlock()
+		variation, err := strconv.Atoi(data)
+		if err != nil {
+			player.socket.Emit("error", "Invalid syntax!")
+			return
+		}
+		err = game.SwitchVariation(variation)
+		server.reviewed(gameID, gameSession, player, err)
+	}
+}
+
+func (server *SocketIOServer) handleGoToNode(gameID string, gameSession *IOGameSession, player *IOPlayer) interface{} {
+	game := gameSession.game
+	return func(data string) {
+		gameSession.lock.Lock()
+		defer gameSession.lock.Unlock()
+		node, err := strconv.Atoi(data)
+		if err != nil {
+			player.socket.Emit("error", "Invalid syntax!")
+			return
+		}
+		err = game.GoTo(node)
+		server.reviewed(gameID, gameSession, player, err)
+	}
+}
+
+func (server *SocketIOServer) handleComment(gameID string, gameSession *IOGameSession, player *IOPlayer) interface{} {
+	game := gameSession.game
+	return func(text string) {
+		gameSession.lock.Lock()
+		defer gameSession.lock.Unlock()
+		game.Comment(text)
+		server.reviewed(gameID, gameSession, player, nil)
+	}
+}
+
+func (server *SocketIOServer) handleMark(gameID string, gameSession *IOGameSession, player *IOPlayer) interface{} {
+	game := gameSession.game
+	return func(data string) {
+		gameSession.lock.Lock()
+		defer gameSession.lock.Unlock()
+		mark, err := ParseMark([]byte(data))
+		if err != nil {
+			player.socket.Emit("error", err.Error())
+			return
+		}
+		err = game.Mark(*mark)
+		server.reviewed(gameID, gameSession, player, err)
+	}
+}
+
+// reviewed notifies the players the reviewed position, its comment or its marks changed
+func (server *SocketIOServer) reviewed(gameID string, gameSession *IOGameSession, player *IOPlayer, err error) {
+	if err != nil {
+		player.socket.Emit("error", err.Error())
+		return
+	}
+	log.Debugf("[%s] Player %s is at node %d\n", gameID, player.piece, gameSession.game.Board.Tree().Current().ID())
+	gameSession.boardChanged(gameID)
+}
+
+// moved notifies the players about the outcome of a move
+func (server *SocketIOServer) moved(gameID string, gameSession *IOGameSession, player *IOPlayer, result MoveResult, err error) {
+	if err == errOutOfTime {
+		player.socket.Emit("error", err.Error())
+		gameSession.boardChanged(gameID)
+		gameSession.gameOver(gameID)
+		return
+	}
+	if err != nil {
+		player.socket.Emit("error", err.Error())
+		return
+	}
+	gameSession.boardChanged(gameID)
+	log.Debugf(gameSession.game.Board.String(false))
+	log.Debugf("[%s] Player %s moved\n", gameID, player.piece)
+	if result == GameOver {
+		log.Debugf("[%s] Both players passed, marking dead pieces\n", gameID)
+		gameSession.scoringStarted(gameID)
 	}
+	gameSession.botReply(gameID)
 }
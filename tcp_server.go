@@ -1,15 +1,21 @@
 package main
 
 import (
-	"errors"
 	"fmt"
 	"net"
+	"net/url"
+	"strings"
+	"time"
 
 	log "github.com/cloudflare/cfssl/log"
 )
 
 type TcpServer struct {
 	port int
+	// gtp serves the Go Text Protocol, every connection gets an engine of its own
+	gtp bool
+	// bot is the name of the bot answering genmove, as given to MakeBot
+	bot string
 }
 
 func (server *TcpServer) start() {
@@ -20,58 +26,115 @@ func (server *TcpServer) start() {
 		return
 	}
 	log.Infof("Go-in-go is ready: listening at %d\n", server.port)
+	if server.gtp {
+		server.serveGTP(ln)
+		return
+	}
 	for {
 		player1, err := ln.Accept()
 		if err != nil {
 			log.Fatalf("Connection issue: %+v\n", err)
 		}
-		player1.Write([]byte("Welcome player! Waiting for partner\n"))
+		player1.Write([]byte("Welcome player!\n"))
+		game, err := getSettings(player1)
+		if err != nil {
+			log.Errorf("Player 1 left: %+v\n", err)
+			player1.Close()
+			continue
+		}
+		player1.Write([]byte("Waiting for partner\n"))
 		log.Infof("Player 1 joined. Waiting for player 2..")
 		player2, err := ln.Accept()
 		if err != nil {
 			log.Fatalf("Connection issue: %+v\n", err)
 		}
-		handleConnection(player1, player2)
+		handleConnection(player1, player2, game)
 
 	}
 }
 
-func parsePosition(data string) (*Position, error) {
-	var x int
-	var y int
-	_, err := fmt.Sscanf(data, "%d %d", &x, &y)
+// serveGTP answers GTP commands on every connection
+func (server *TcpServer) serveGTP(ln net.Listener) {
+	// Every connection makes its own bot, the name is checked once first
+	_, err := MakeBot(server.bot)
 	if err != nil {
-		return nil, errors.New("Invalid move: should be: x y")
+		log.Fatalf("%s\n", err)
+	}
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Fatalf("Connection issue: %+v\n", err)
+		}
+		log.Infof("GTP controller %+v connected", conn.RemoteAddr())
+		go func(conn net.Conn) {
+			defer conn.Close()
+			bot, err := MakeBot(server.bot)
+			if err == nil {
+				err = MakeGTPEngine(bot).ServeGTP(conn, conn)
+			}
+			if err != nil {
+				log.Errorf("GTP controller %+v left: %+v\n", conn.RemoteAddr(), err)
+			}
+		}(conn)
+	}
+}
+
+// getSettings asks the player for the game settings until valid ones are chosen
+// Settings are written like a query string, e.g. "rules=japanese&handicap=2"
+func getSettings(conn net.Conn) (*Game, error) {
+	buffer := make([]byte, 1024)
+	for {
+		conn.Write([]byte(fmt.Sprintf("0, Choose settings as size=(2-25|7x9)&rules=(%s)&handicap=(2-9)&first=(black|white)&time=(absolute|fischer|byoyomi|canadian)&main=10m&increment=10s&periods=5&period=30s&stones=25, or empty for defaults\n", strings.Join(RuleSetNames(), "|"))))
+		n, err := conn.Read(buffer)
+		if err != nil {
+			return nil, err
+		}
+		settings, err := url.ParseQuery(strings.TrimSpace(string(buffer[:n])))
+		if err != nil {
+			conn.Write([]byte(fmt.Sprintf("1, Invalid settings: %s\n", err)))
+			continue
+		}
+		game, err := CreateGameFromSettings(settings)
+		if err != nil {
+			conn.Write([]byte(fmt.Sprintf("1, %s\n", err)))
+			continue
+		}
+		return game, nil
 	}
-	return &Position{x, y}, nil
 }
 
-func getMove(conn net.Conn) (*Position, error) {
+// getMove reads the move of piece, a connection error is returned as it is
+// Timed games stop waiting once the time of the player is over
+func getMove(conn net.Conn, game *Game, piece Piece) (*Move, error) {
 	buffer := make([]byte, 1024)
+	if game.Clock != nil {
+		conn.SetReadDeadline(time.Now().Add(game.Clock.TimeLeft(piece)))
+		defer conn.SetReadDeadline(time.Time{})
+	}
 	n, err := conn.Read(buffer)
 	if err != nil {
-		log.Errorf("Cannot read %+v\n", err)
+		return nil, err
 	}
 	data := string(buffer[:n])
-	var position *Position
-	position, err = parsePosition(data)
+	var move *Move
+	move, err = ParseMove(data, piece)
 	if err != nil {
-		return nil, errors.New(fmt.Sprintf("Should be 'x y' got: %s", data))
+		return nil, &moveError{fmt.Sprintf("Should be 'x y' or 'pass' got: %s", data)}
 	}
-	log.Debugf("Parsed position: %+v", *position)
-	return position, nil
+	log.Debugf("Parsed move: %s", move)
+	return move, nil
 }
 
-func handleConnection(player1 net.Conn, player2 net.Conn) {
-	log.Debugf("%+v Vs %+v", player1.RemoteAddr(), player2.RemoteAddr())
-	game := CreateGame(9, 4.5)
+func handleConnection(player1 net.Conn, player2 net.Conn, game *Game) {
+	log.Debugf("%+v Vs %+v playing %s rules", player1.RemoteAddr(), player2.RemoteAddr(), game.Rules.Name)
 	defer player1.Close()
 	defer player2.Close()
 	var currentPlayer *net.Conn
 	var otherPlayer *net.Conn
+	game.StartClock()
 	for {
 		// Assigning the proper player
-		if game.Turn == White {
+		if game.Turn == game.FirstPlayer() {
 			currentPlayer = &player1
 			otherPlayer = &player2
 		} else {
@@ -80,21 +143,62 @@ func handleConnection(player1 net.Conn, player2 net.Conn) {
 		}
 
 		// Displaying board
-		player1.Write([]byte(game.Board.String(false)))
-		player2.Write([]byte(game.Board.String(false)))
+		showBoard(player1, player2, game)
 
 		// Instructing players
 		(*currentPlayer).Write([]byte("0, " + game.Turn.String() + "'s turn\n"))
 		(*otherPlayer).Write([]byte("0, Wait for your turn\n"))
-		move, err := getMove(*currentPlayer)
-		if err != nil {
+		move, err := getMove(*currentPlayer, game, game.Turn)
+		if game.CheckTime() {
+			showResult(player1, player2, game)
+			return
+		}
+		if _, ok := err.(*moveError); ok {
 			(*currentPlayer).Write([]byte(fmt.Sprintf("1, Invalid move: %s\n", err)))
 			continue
 		}
-		log.Debugf("%s tried to move to %+v", game.Turn.String(), *move)
-		result, err := game.Move(&Move{(*move).X, (*move).Y, game.Turn})
+		if err != nil {
+			log.Errorf("%s left: %+v\n", game.Turn.Name(), err)
+			(*otherPlayer).Write([]byte("2, Other player left\n"))
+			return
+		}
+		log.Debugf("%s tried %s", game.Turn.String(), move)
+		result, err := game.Move(move)
+		if result == GameOver {
+			// There's no way to mark dead pieces over TCP, so the board is scored as it is
+			game.AcceptScore(White)
+			game.AcceptScore(Black)
+			showResult(player1, player2, game)
+			return
+		}
 		if result != Ok {
 			(*currentPlayer).Write([]byte(fmt.Sprintf("1, Invalid move: %v\n", err.Error())))
 		}
 	}
 }
+
+// moveError is a move which couldn't be read, the player is asked again
+type moveError struct {
+	message string
+}
+
+func (err *moveError) Error() string {
+	return err.message
+}
+
+// showBoard writes the board, and the clock of timed games, to both players
+func showBoard(player1 net.Conn, player2 net.Conn, game *Game) {
+	board := game.Board.String(false)
+	if game.Clock != nil {
+		board += fmt.Sprintf("0, Clock: %s\n", game.Clock)
+	}
+	player1.Write([]byte(board))
+	player2.Write([]byte(board))
+}
+
+// showResult writes the final board and the result to both players
+func showResult(player1 net.Conn, player2 net.Conn, game *Game) {
+	showBoard(player1, player2, game)
+	player1.Write([]byte(fmt.Sprintf("2, Game over: %s\n", game.Result)))
+	player2.Write([]byte(fmt.Sprintf("2, Game over: %s\n", game.Result)))
+}
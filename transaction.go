@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+)
+
+// MoveTransaction is a validated move with the position it results in, not yet applied to the board
+// The position is computed in a scratch grid, and becomes the board on Commit
+type MoveTransaction struct {
+	board   *Board
+	move    Move
+	outcome *moveOutcome
+	// version of the board the transaction was prepared for
+	version int
+}
+
+// Prepare validates the move and computes the resulting position, without changing the board
+// Only the latest prepared transaction can be committed, as they share the scratch grid
+func (board *Board) Prepare(move *Move) (*MoveTransaction, error) {
+	if move.IsPass() {
+		return nil, errors.New("Passing doesn't change the board, use Pass instead")
+	}
+	outcome, err := board.outcome(move)
+	if err != nil {
+		return nil, err
+	}
+	if len(board.scratch) != board.width {
+		board.scratch = board.data.Clone()
+	}
+	for x := range board.data {
+		copy(board.scratch[x], board.data[x])
+	}
+	board.scratch[move.x][move.y].piece = move.piece
+	removed := outcome.captured
+	if outcome.suicide {
+		board.scratch[move.x][move.y].piece = Empty
+		removed = outcome.allies
+	}
+	for _, chain := range removed {
+		for _, stone := range chain.stones {
+			board.scratch[stone.X][stone.Y].piece = Empty
+		}
+	}
+	board.version++
+	return &MoveTransaction{board, *move, outcome, board.version}, nil
+}
+
+// Pieces is the position after the move
+func (transaction *MoveTransaction) Pieces() [][]string {
+	grid := transaction.board.scratch
+	data := make([][]string, len(grid))
+	for x := range data {
+		data[x] = make([]string, len(grid[x]))
+		for y := range data[x] {
+			data[x][y] = grid[x][y].piece.String()
+		}
+	}
+	return data
+}
+
+// Captured is the number of opponent pieces the move removes
+func (transaction *MoveTransaction) Captured() int {
+	captured := 0
+	for _, chain := range transaction.outcome.captured {
+		captured += len(chain.stones)
+	}
+	return captured
+}
+
+// Commit applies the move to the board
+// Fails without changing anything if the board changed since the transaction was prepared
+func (transaction *MoveTransaction) Commit() error {
+	board := transaction.board
+	if board.version != transaction.version {
+		return errors.New("Board changed since the move was prepared")
+	}
+	board.version++
+	move := &transaction.move
+	// The scratch grid becomes the board, and the old grid the next scratch
+	board.data, board.scratch = board.scratch, board.data
+	// Chains and the hash follow the same changes, the pieces already have them
+	placed := board.placeStone(move.x, move.y, move.piece)
+	captured := 0
+	for _, chain := range transaction.outcome.captured {
+		captured += board.removeChain(chain)
+	}
+	suicided := 0
+	if transaction.outcome.suicide {
+		suicided = board.removeChain(placed)
+	}
+	board.moves++
+	board.captures.Add(move.piece, captured)
+	board.captures.Add(move.piece.Opponent(), suicided)
+	board.tree.Play(move)
+	board.boardHistory.Enqueue(&(board.data), board.hash, move.piece.Opponent(), board.captures)
+	return nil
+}
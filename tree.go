@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Shape is the kind of mark drawn on a cell when reviewing a game
+type Shape int
+
+const (
+	// Circle marks a cell with a circle
+	Circle Shape = iota
+	// Cross marks a cell with an X
+	Cross
+	// Square marks a cell with a square
+	Square
+	// Triangle marks a cell with a triangle
+	Triangle
+	// Label writes a short text on a cell
+	Label
+)
+
+func (shape Shape) String() string {
+	names := [...]string{
+		"circle",
+		"cross",
+		"square",
+		"triangle",
+		"label",
+	}
+	if shape < Circle || shape > Label {
+		return "unknown"
+	}
+	return names[shape]
+}
+
+func (shape Shape) MarshalJSON() ([]byte, error) {
+	return json.Marshal(shape.String())
+}
+
+// ParseShape reads the name of a shape, such as "circle"
+func ParseShape(name string) (Shape, error) {
+	for shape := Circle; shape <= Label; shape++ {
+		if strings.EqualFold(name, shape.String()) {
+			return shape, nil
+		}
+	}
+	return Circle, fmt.Errorf("Invalid mark %s: should be circle, cross, square, triangle or label", name)
+}
+
+// Mark is a shape or label drawn on a cell of a node
+type Mark struct {
+	X     int    `json:"x"`
+	Y     int    `json:"y"`
+	Shape Shape  `json:"shape"`
+	Label string `json:"label,omitempty"`
+}
+
+// ParseMark reads a mark in the form of {"x": 1, "y": 2, "shape": "circle"}, labels have a "label" as well
+func ParseMark(data []byte) (*Mark, error) {
+	request := struct {
+		X     int    `json:"x"`
+		Y     int    `json:"y"`
+		Shape string `json:"shape"`
+		Label string `json:"label"`
+	}{}
+	err := json.Unmarshal(data, &request)
+	if err != nil {
+		return nil, errors.New("Invalid mark: should have 'x', 'y' and 'shape'")
+	}
+	shape, err := ParseShape(request.Shape)
+	if err != nil {
+		return nil, err
+	}
+	return &Mark{request.X, request.Y, shape, request.Label}, nil
+}
+
+// Node is a move in the game tree, the moves played after it are its variations
+type Node struct {
+	id       int
+	move     *Move
+	parent   *Node
+	children []*Node
+	// selected is the variation which was played last, and is redone first
+	selected int
+	// setup are the pieces placed before the game, only on the root
+	setup   []*Move
+	comment string
+	marks   map[Position]Mark
+}
+
+// ID identifies the node in its tree
+func (node *Node) ID() int {
+	return node.id
+}
+
+// Move is the move the node was reached by, or nil for the root
+func (node *Node) Move() *Move {
+	return node.move
+}
+
+// Variations are the moves played after the node, the first one is the main line
+func (node *Node) Variations() []*Node {
+	return node.children
+}
+
+// Comment is the text written on the node
+func (node *Node) Comment() string {
+	return node.comment
+}
+
+// Marks lists the marks drawn on the node
+func (node *Node) Marks() []Mark {
+	marks := make([]Mark, 0, len(node.marks))
+	for _, mark := range node.marks {
+		marks = append(marks, mark)
+	}
+	// Keep the order stable for clients
+	sort.Slice(marks, func(i, j int) bool {
+		if marks[i].X != marks[j].X {
+			return marks[i].X < marks[j].X
+		}
+		return marks[i].Y < marks[j].Y
+	})
+	return marks
+}
+
+// isAncestorOf checks if other is the node or one of the nodes after it
+func (node *Node) isAncestorOf(other *Node) bool {
+	for ; other != nil; other = other.parent {
+		if other == node {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON describes the node and all the variations after it
+func (node *Node) MarshalJSON() ([]byte, error) {
+	type nodeMove struct {
+		X     int   `json:"x"`
+		Y     int   `json:"y"`
+		Piece Piece `json:"piece"`
+		Pass  bool  `json:"pass,omitempty"`
+	}
+	var move *nodeMove
+	if node.move != nil {
+		move = &nodeMove{node.move.x, node.move.y, node.move.piece, node.move.IsPass()}
+	}
+	return json.Marshal(&struct {
+		ID         int       `json:"id"`
+		Move       *nodeMove `json:"move,omitempty"`
+		Comment    string    `json:"comment,omitempty"`
+		Marks      []Mark    `json:"marks,omitempty"`
+		Variations []*Node   `json:"variations"`
+	}{
+		node.id,
+		move,
+		node.comment,
+		node.Marks(),
+		node.children,
+	})
+}
+
+// GameTree has every move played in a game, including the variations tried when undoing or reviewing
+type GameTree struct {
+	root    *Node
+	current *Node
+	// nodes are all the nodes by their id
+	nodes []*Node
+}
+
+// MakeGameTree creates a tree with only the starting position
+func MakeGameTree() *GameTree {
+	root := &Node{0, nil, nil, []*Node{}, 0, []*Move{}, "", map[Position]Mark{}}
+	return &GameTree{
+		root,
+		root,
+		[]*Node{root},
+	}
+}
+
+// Root is the node of the starting position
+func (tree *GameTree) Root() *Node {
+	return tree.root
+}
+
+// Current is the node of the position on the board
+func (tree *GameTree) Current() *Node {
+	return tree.current
+}
+
+// Node finds a node by its id
+func (tree *GameTree) Node(id int) (*Node, error) {
+	if id < 0 || id >= len(tree.nodes) {
+		return nil, fmt.Errorf("Node %d not found", id)
+	}
+	return tree.nodes[id], nil
+}
+
+// Play follows the move from the current node, adding it as a new variation if it wasn't played before
+func (tree *GameTree) Play(move *Move) *Node {
+	for i, child := range tree.current.children {
+		if *child.move == *move {
+			tree.current.selected = i
+			tree.current = child
+			return child
+		}
+	}
+	child := &Node{len(tree.nodes), move, tree.current, []*Node{}, 0, nil, "", map[Position]Mark{}}
+	tree.nodes = append(tree.nodes, child)
+	tree.current.children = append(tree.current.children, child)
+	tree.current.selected = len(tree.current.children) - 1
+	tree.current = child
+	return child
+}
+
+// Back goes to the node before the current one, and returns the move which was left
+func (tree *GameTree) Back() (*Move, error) {
+	if tree.current.parent == nil {
+		return nil, errors.New("No moves to undo")
+	}
+	move := tree.current.move
+	tree.current = tree.current.parent
+	return move, nil
+}
+
+// Next is the variation of the current node played last, or nil at the end of the line
+func (tree *GameTree) Next() *Node {
+	if len(tree.current.children) == 0 {
+		return nil
+	}
+	return tree.current.children[tree.current.selected]
+}
+
+// Moves are the moves from the starting position to the current node
+func (tree *GameTree) Moves() []*Move {
+	return tree.path(tree.current)
+}
+
+// Promote makes the current node the first variation of the node before it, moving the others after it
+// The game promotes the moves it plays, so the line the game was played along stays the main line
+func (tree *GameTree) Promote() {
+	node := tree.current
+	parent := node.parent
+	if parent == nil {
+		return
+	}
+	for i, child := range parent.children {
+		if child == node {
+			copy(parent.children[1:i+1], parent.children[:i])
+			parent.children[0] = node
+			parent.selected = 0
+			return
+		}
+	}
+}
+
+// MainLine are the moves following the first variation of every node
+func (tree *GameTree) MainLine() []*Move {
+	moves := []*Move{}
+	for node := tree.root; len(node.children) > 0; node = node.children[0] {
+		moves = append(moves, node.children[0].move)
+	}
+	return moves
+}
+
+// path are the moves from the starting position to node
+func (tree *GameTree) path(node *Node) []*Move {
+	moves := []*Move{}
+	for ; node.parent != nil; node = node.parent {
+		moves = append(moves, node.move)
+	}
+	for i, j := 0, len(moves)-1; i < j; i, j = i+1, j-1 {
+		moves[i], moves[j] = moves[j], moves[i]
+	}
+	return moves
+}
+
+// Setup records a piece placed before the game
+func (tree *GameTree) Setup(move *Move) {
+	tree.root.setup = append(tree.root.setup, move)
+}
+
+// SetComment writes text on the current node
+func (tree *GameTree) SetComment(text string) {
+	tree.current.comment = text
+}
+
+// SetMark draws a mark on the current node, a mark already on the cell is replaced
+func (tree *GameTree) SetMark(mark Mark) {
+	tree.current.marks[Position{mark.X, mark.Y}] = mark
+}
+
+// RemoveMark erases the mark of the current node at (x, y)
+func (tree *GameTree) RemoveMark(x int, y int) {
+	delete(tree.current.marks, Position{x, y})
+}
+
+func (tree *GameTree) String() string {
+	var str strings.Builder
+	for _, move := range tree.Moves() {
+		str.WriteString(move.String() + "\n")
+	}
+	return str.String()
+}
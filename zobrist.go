@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math/rand"
+)
+
+// zobristKeys has a random key for every piece at every cell of the biggest board
+// A position is hashed by xor-ing the keys of its pieces
+var zobristKeys [maxBoardSize][maxBoardSize][3]uint64
+
+// zobristTurn has a random key for the piece which is to move, used by situational superko
+var zobristTurn [3]uint64
+
+func init() {
+	// Fixed seed so hashes are the same between runs
+	random := rand.New(rand.NewSource(19))
+	for x := range zobristKeys {
+		for y := range zobristKeys[x] {
+			// Empty cells don't change the hash
+			zobristKeys[x][y][White] = random.Uint64()
+			zobristKeys[x][y][Black] = random.Uint64()
+		}
+	}
+	zobristTurn[White] = random.Uint64()
+	zobristTurn[Black] = random.Uint64()
+}
+
+// zobristKey is the key of piece at (x, y)
+func zobristKey(x int, y int, piece Piece) uint64 {
+	return zobristKeys[x][y][piece]
+}
+
+// Hash is the zobrist hash of the pieces on the grid
+func (grid *Grid) Hash() uint64 {
+	var hash uint64
+	for x := range *grid {
+		for y := range (*grid)[x] {
+			hash ^= zobristKey(x, y, (*grid)[x][y].piece)
+		}
+	}
+	return hash
+}
+
+// KoRule decides which repeated positions are forbidden
+type KoRule int
+
+const (
+	// SimpleKo forbids recreating the position from before the opponent's last move
+	SimpleKo KoRule = iota
+	// PositionalSuperko forbids recreating any previous position
+	PositionalSuperko
+	// SituationalSuperko forbids recreating any previous position with the same player to move
+	SituationalSuperko
+)
+
+func (rule KoRule) String() string {
+	names := [...]string{
+		"simple",
+		"positional",
+		"situational",
+	}
+	if rule < SimpleKo || rule > SituationalSuperko {
+		return "unknown"
+	}
+	return names[rule]
+}